@@ -20,15 +20,14 @@ type App struct {
 	conf  *Config
 	cron  *cron.Cron
 	tasks *tasks.Dispatcher
+	hub   *Hub
+	index *TwtIndex
 }
 
 func NewApp(options ...Option) (*App, error) {
-	conf := NewConfig()
-
-	for _, opt := range options {
-		if err := opt(conf); err != nil {
-			return nil, err
-		}
+	conf, err := NewConfigWithOptions(options...)
+	if err != nil {
+		return nil, err
 	}
 
 	if Exists(conf.FeedsFile) {
@@ -38,10 +37,17 @@ func NewApp(options ...Option) (*App, error) {
 		}
 	}
 
+	hub, err := NewHub(conf)
+	if err != nil {
+		log.WithError(err).Error("error loading websub hub")
+		return nil, fmt.Errorf("error loading websub hub: %w", err)
+	}
+	conf.hub = hub
+
 	cron := cron.New()
 	tasks := tasks.NewDispatcher(10, 100) // TODO: Make this configurable?
 
-	return &App{conf: conf, cron: cron, tasks: tasks}, nil
+	return &App{conf: conf, cron: cron, tasks: tasks, hub: hub, index: NewTwtIndex(conf)}, nil
 }
 
 func (app *App) initRoutes() *mux.Router {
@@ -53,6 +59,11 @@ func (app *App) initRoutes() *mux.Router {
 	router.HandleFunc("/we-are-feeds.txt", app.WeAreFeedsHandler).Methods(http.MethodGet, http.MethodHead)
 	router.HandleFunc("/{name}/twtxt.txt", app.FeedHandler).Methods(http.MethodGet, http.MethodHead)
 	router.HandleFunc("/{name}/avatar.png", app.AvatarHandler).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{name}/media/{file}", app.MediaHandler).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/{name}/twt/{hash}", app.TwtHandler).Methods(http.MethodGet, http.MethodHead)
+
+	router.HandleFunc("/websub", app.HubHandler).Methods(http.MethodPost)
+	router.HandleFunc("/websub/callback/{name}", app.WebSubCallbackHandler).Methods(http.MethodGet, http.MethodPost)
 
 	return router
 }
@@ -70,6 +81,30 @@ func (app *App) setupCronJobs() error {
 		log.Infof("Started background job %s (%s)", name, jobSpec.Schedule)
 	}
 
+	bots, err := NewBots(app.conf)
+	if err != nil {
+		return err
+	}
+	for _, name := range BotNames(bots) {
+		bot := bots[name]
+		schedule := BotSchedule(app.conf, bot)
+		if err := app.cron.AddJob(schedule, NewBotJob(app.conf, bot)); err != nil {
+			return fmt.Errorf("error scheduling bot %s: %w", name, err)
+		}
+		log.Infof("Started bot %s (%s)", name, schedule)
+	}
+
+	for name, feed := range app.conf.Feeds {
+		if feed == nil || feed.URI == "" || feed.Schedule == "" {
+			continue
+		}
+
+		if err := app.cron.AddJob(feed.Schedule, NewUpdateFeedJob(app.conf, name)); err != nil {
+			return fmt.Errorf("error scheduling feed %s: %w", name, err)
+		}
+		log.Infof("Scheduled feed %s (%s)", name, feed.Schedule)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// ItemLimit returns the most items an update of the feed `name` emits, the
+// initial backfill limit if the feed is new (no file `exists` yet) and
+// otherwise the per-run cap, or 0 if it is unlimited. A feed being explicitly
+// backfilled is limited to the number of items requested.
+func (conf *Config) ItemLimit(name string, exists bool) int {
+	feed := conf.Feeds[name]
+	if feed != nil && feed.backfill > 0 {
+		return feed.backfill
+	}
+
+	if exists {
+		return conf.MaxItems
+	}
+
+	if feed != nil && feed.Backfill != 0 {
+		if feed.Backfill < 0 {
+			return 0
+		}
+		return feed.Backfill
+	}
+	return conf.Backfill
+}
+
+// backfilling returns true if the feed `name` is being explicitly backfilled.
+func (conf *Config) backfilling(name string) bool {
+	feed := conf.Feeds[name]
+	return feed != nil && feed.backfill > 0
+}
+
+// BackfillFeed updates the feed `name` with up to `n` of the most recent
+// items of its history it has not written yet, regardless of when it was
+// last updated and of the initial backfill limit and the per-run cap.
+//
+// Backfilling takes no lock on the feed, so the feed must not be updated at
+// the same time by a running server (or another backfill).
+func BackfillFeed(conf *Config, name string, n int) error {
+	feed := conf.Feeds[name]
+	if feed == nil {
+		return fmt.Errorf("error: unknown feed %q", name)
+	}
+	if n <= 0 {
+		return fmt.Errorf("error: invalid number of items to backfill %d", n)
+	}
+
+	feed.backfill = n
+	defer func() { feed.backfill = 0 }()
+
+	return UpdateFeed(conf, name, feed.URI)
+}
+
+// recordItemKeys remembers the twt hashes of the items of the feed `name`
+// written by their item keys.
+func recordItemKeys(conf *Config, name string, keys map[string]string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	states := make(map[string]string)
+	if err := LoadState(conf, name, "keys", &states); err != nil {
+		return err
+	}
+
+	for key, hash := range keys {
+		states[key] = hash
+	}
+
+	return SaveState(conf, name, "keys", states)
+}
+
+// writtenItems returns the keys of the items written to the feed `name` or
+// its archives, and the links to the sources of its twts for items written
+// before their keys were remembered. The keys of items whose twts are gone
+// are forgotten.
+func writtenItems(conf *Config, name string) (map[string]bool, error) {
+	keys := make(map[string]string)
+	if err := LoadState(conf, name, "keys", &keys); err != nil {
+		return nil, err
+	}
+
+	url := URLForFeed(conf, name)
+	hashes := make(map[string]bool)
+	written := make(map[string]bool)
+
+	err := readFeedTwts(filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name)), func(twt Twt) {
+		hashes[twt.Hash(url)] = true
+		if link := TwtSourceLink(twt.Text); link != "" {
+			written[link] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := false
+	for key, hash := range keys {
+		if !hashes[hash] {
+			delete(keys, key)
+			pruned = true
+			continue
+		}
+		written[key] = true
+	}
+
+	if pruned {
+		if err := SaveState(conf, name, "keys", keys); err != nil {
+			return nil, err
+		}
+	}
+
+	return written, nil
+}
+
+// newestItems returns the `n` most recently published of the `items` in
+// their original order, or all of them if `n` is 0.
+func newestItems(items []*gofeed.Item, n int) []*gofeed.Item {
+	if n <= 0 || len(items) <= n {
+		return items
+	}
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return items[order[i]].PublishedParsed.After(*items[order[j]].PublishedParsed)
+	})
+
+	keep := make(map[int]bool)
+	for _, i := range order[:n] {
+		keep[i] = true
+	}
+
+	var newest []*gofeed.Item
+	for i, item := range items {
+		if keep[i] {
+			newest = append(newest, item)
+		}
+	}
+	return newest
+}
+
+// newestTwts returns the `n` most recent of the `twts`, which are sorted
+// chronologically, or all of them if `n` is 0.
+func newestTwts(twts []Twt, n int) []Twt {
+	if n <= 0 || len(twts) <= n {
+		return twts
+	}
+	return twts[len(twts)-n:]
+}
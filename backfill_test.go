@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemLimit(t *testing.T) {
+	conf := NewConfig()
+	conf.Feeds["example"] = &Feed{Name: "example"}
+	conf.Feeds["history"] = &Feed{Name: "history", Backfill: -1}
+	conf.Feeds["more"] = &Feed{Name: "more", Backfill: 100}
+
+	assert.Equal(t, maxTweets, conf.ItemLimit("example", false))
+	assert.Equal(t, DefaultMaxItems, conf.ItemLimit("example", true))
+	assert.Equal(t, 0, conf.ItemLimit("history", false))
+	assert.Equal(t, 100, conf.ItemLimit("more", false))
+	assert.Equal(t, DefaultMaxItems, conf.ItemLimit("more", true))
+
+	conf.Feeds["example"].backfill = 5
+	assert.Equal(t, 5, conf.ItemLimit("example", true))
+}
+
+func TestAppendFeedItemsLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.Backfill = 3
+	conf.MaxItems = 5
+	conf.Feeds["example"] = &Feed{Name: "example"}
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := func(from, to int) []*gofeed.Item {
+		var items []*gofeed.Item
+		for i := from; i < to; i++ {
+			published := start.Add(time.Duration(i) * time.Hour)
+			items = append(items, &gofeed.Item{Title: fmt.Sprintf("Item %d", i), PublishedParsed: &published})
+		}
+		return items
+	}
+	titles := func() []string {
+		twts, err := ReadTwts(filepath.Join(conf.DataDir, "example.txt"))
+		require.NoError(err)
+		var titles []string
+		for _, twt := range twts {
+			titles = append(titles, strings.Trim(twt.Text, "*"))
+		}
+		return titles
+	}
+
+	// A new feed is only backfilled with the most recent items.
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", items(0, 20)))
+	assert.Equal([]string{"Item 17", "Item 18", "Item 19"}, titles())
+
+	// Updates are capped.
+	fn := filepath.Join(conf.DataDir, "example.txt")
+	require.NoError(os.Chtimes(fn, start.Add(20*time.Hour), start.Add(20*time.Hour)))
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", items(0, 30)))
+	assert.Len(titles(), 8)
+	assert.Equal("Item 25", titles()[3])
+
+	// Backfilling writes the most recent items not written yet, however old.
+	conf.Feeds["example"].backfill = 2
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", items(0, 30)))
+	assert.Equal([]string{"Item 23", "Item 24"}, titles()[8:])
+
+	// Items are told apart by their keys rather than their timestamps, also
+	// once rotated into the feed's archives.
+	require.NoError(RotateFile(fn))
+	conf.Feeds["example"].backfill = 1
+	same := items(24, 25)[0]
+	same.Title = "Item 24b"
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", append(items(0, 30), same)))
+	assert.Equal([]string{"Item 24b"}, titles())
+}
+
+func TestWriteFeedItemsLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.Backfill = 2
+	conf.MaxItems = 3
+	conf.Feeds["example"] = &Feed{Name: "example"}
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var items []*gofeed.Item
+	for i := 0; i < 10; i++ {
+		published := start.Add(time.Duration(i) * time.Hour)
+		items = append(items, &gofeed.Item{Title: fmt.Sprintf("Item %d", i), PublishedParsed: &published})
+	}
+
+	// A new feed is only backfilled with the most recent items, later writes
+	// are capped.
+	require.NoError(WriteFeedItems(conf, "example", items[:5]))
+	require.NoError(WriteFeedItems(conf, "example", items[5:]))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "example.txt"))
+	require.NoError(err)
+	require.Len(twts, 5)
+	assert.Equal("**Item 3**", twts[0].Text)
+	assert.Equal("**Item 7**", twts[2].Text)
+}
+
+func TestBackfillFeed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var body strings.Builder
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&body, "%s\tTwt %d\n", start.Add(time.Duration(i)*time.Hour).Format(time.RFC3339), i)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body.String())
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.FeedsFile = filepath.Join(conf.DataDir, "feeds.yaml")
+	uri := "twtxt+" + server.URL + "/twtxt.txt"
+	conf.Feeds["alice"] = &Feed{Name: "alice", URI: uri}
+
+	require.NoError(UpdateFeed(conf, "alice", uri))
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "alice.txt"))
+	require.NoError(err)
+	require.Len(twts, maxTweets)
+	assert.Equal("Twt 10", twts[0].Text)
+
+	require.NoError(BackfillFeed(conf, "alice", 5))
+	twts, err = ReadTwts(filepath.Join(conf.DataDir, "alice.txt"))
+	require.NoError(err)
+	require.Len(twts, maxTweets+5)
+	assert.Equal("Twt 5", twts[maxTweets].Text)
+	assert.Equal(0, conf.Feeds["alice"].backfill)
+
+	assert.Error(BackfillFeed(conf, "bob", 5))
+	assert.Error(BackfillFeed(conf, "alice", 0))
+}
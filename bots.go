@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron"
+	log "github.com/sirupsen/logrus"
+)
+
+// botTimeout is the most time a bot is given to generate its twts.
+const botTimeout = time.Minute
+
+// Bot generates the twts of an automated feed on a schedule.
+type Bot interface {
+	// Name is the name of the bot's feed
+	Name() string
+
+	// Description is the description of the bot's feed
+	Description() string
+
+	// Schedule is the cron spec the bot runs on unless overridden
+	Schedule() string
+
+	// Generate returns the twts of the bot run at `now`, if any
+	Generate(ctx context.Context, now time.Time) ([]Twt, error)
+}
+
+// EphemeralBot is a Bot whose feed only ever holds the twts it generated
+// last, replacing those generated before.
+type EphemeralBot interface {
+	Bot
+
+	Ephemeral() bool
+}
+
+// StatefulBot is a Bot whose state of a run is only saved once the twts it
+// generated, if any, have been written to its feed, so a failed run is not
+// counted.
+type StatefulBot interface {
+	Bot
+
+	// Commit saves the state of the bot's last run
+	Commit() error
+}
+
+// BotFactory creates the bot of the kind it is registered as generating the
+// feed `name`, configured by the feed's `bot` settings.
+type BotFactory func(conf *Config, name string, feed *Feed) (Bot, error)
+
+// FeedBot configures the bot generating a feed of type `bot`.
+type FeedBot struct {
+	// Kind is the kind of bot registered, the feed's name if empty
+	Kind string `yaml:"kind,omitempty"`
+
+	// Disabled disables the bot
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Template, Vars and Lists are the template twted by a template bot and
+	// the variables and lists of values it may refer to
+	Template string              `yaml:"template,omitempty"`
+	Vars     map[string]string   `yaml:"vars,omitempty"`
+	Lists    map[string][]string `yaml:"lists,omitempty"`
+
+	// Checks are the endpoints and ports checked by a monitor bot
+	Checks []MonitorCheck `yaml:"checks,omitempty"`
+}
+
+type botKind struct {
+	factory BotFactory
+	builtin bool
+}
+
+var botKinds = make(map[string]botKind)
+
+// RegisterBot registers the bot `factory` as the kind of bot `kind`. Builtin
+// bots generate the feed named after their kind unless it is disabled, other
+// kinds only generate feeds configured with them.
+func RegisterBot(kind string, factory BotFactory, builtin bool) {
+	botKinds[kind] = botKind{factory: factory, builtin: builtin}
+}
+
+// NewBots returns the bots enabled, by the names of their feeds. The feeds of
+// builtin bots not declared in `conf.Feeds` are added to it, but never saved,
+// and a builtin bot does not take over a declared feed of another type.
+func NewBots(conf *Config) (map[string]Bot, error) {
+	kinds := make(map[string]string)
+	for kind, bot := range botKinds {
+		if bot.builtin {
+			kinds[kind] = kind
+		}
+	}
+	for name, feed := range conf.Feeds {
+		if feed == nil || feed.Type != FeedTypeBot {
+			continue
+		}
+		kind := name
+		if feed.Bot != nil && feed.Bot.Kind != "" {
+			kind = feed.Bot.Kind
+		}
+		kinds[name] = kind
+	}
+
+	bots := make(map[string]Bot)
+	for name, kind := range kinds {
+		feed := conf.Feeds[name]
+		if feed != nil && feed.Type != FeedTypeBot {
+			log.Warnf("not running builtin bot %s as feed %s is a %s feed", kind, name, feed.Type)
+			continue
+		}
+		if feed != nil && feed.Bot != nil && feed.Bot.Disabled {
+			continue
+		}
+
+		bot, ok := botKinds[kind]
+		if !ok {
+			return nil, fmt.Errorf("error: unknown kind of bot %q for %s", kind, name)
+		}
+
+		builtin := feed == nil || feed.builtin
+		if feed == nil {
+			feed = &Feed{Name: name, Type: FeedTypeBot}
+		}
+
+		b, err := bot.factory(conf, name, feed)
+		if err != nil {
+			return nil, fmt.Errorf("error creating bot %s: %w", name, err)
+		}
+
+		if builtin {
+			feed.builtin = true
+			feed.Description = b.Description()
+			setBotAvatar(conf, feed)
+			conf.Feeds[name] = feed
+		}
+
+		bots[name] = b
+	}
+
+	return bots, nil
+}
+
+// BotSchedule returns the cron spec the `bot` runs on, the schedule of its
+// feed if overridden.
+func BotSchedule(conf *Config, bot Bot) string {
+	if feed := conf.Feeds[bot.Name()]; feed != nil && feed.Schedule != "" {
+		return feed.Schedule
+	}
+	return bot.Schedule()
+}
+
+// BotNames returns the names of the `bots` sorted.
+func BotNames(bots map[string]Bot) []string {
+	var names []string
+	for name := range bots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func setBotAvatar(conf *Config, feed *Feed) {
+	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.png", feed.Name))
+	if !Exists(fn) || feed.Avatar != "" {
+		return
+	}
+
+	feed.Avatar = fmt.Sprintf("%s/%s/avatar.png", conf.BaseURL, feed.Name)
+	if avatarHash, err := FastHashFile(fn); err == nil {
+		feed.Avatar += "#" + avatarHash
+	} else {
+		log.WithError(err).Warnf("error updating avatar hash for %s", feed.Name)
+	}
+}
+
+// BotJob runs a bot and appends the twts it generates to its feed.
+type BotJob struct {
+	conf *Config
+	bot  Bot
+}
+
+func NewBotJob(conf *Config, bot Bot) cron.Job {
+	return &BotJob{conf: conf, bot: bot}
+}
+
+func (job *BotJob) Run() {
+	if err := RunBot(job.conf, job.bot, time.Now().UTC()); err != nil {
+		log.WithError(err).Errorf("error running bot %s", job.bot.Name())
+	}
+}
+
+// RunBot runs the `bot` at `now` and appends the twts it generates to its
+// feed.
+func RunBot(conf *Config, bot Bot, now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), botTimeout)
+	defer cancel()
+
+	twts, err := bot.Generate(ctx, now)
+	if err != nil {
+		return err
+	}
+	if len(twts) == 0 {
+		return commitBot(bot)
+	}
+
+	name := bot.Name()
+	flags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	if b, ok := bot.(EphemeralBot); ok && b.Ephemeral() {
+		flags |= os.O_TRUNC
+	}
+
+	ts, err := LoadTimestamps(conf, name)
+	if err != nil {
+		return err
+	}
+
+	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name))
+	f, err := os.OpenFile(fn, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening feed %s for writing: %w", name, err)
+	}
+	defer f.Close()
+
+	for _, twt := range twts {
+		if err := AppendTwt(f, twt.Text, ts.Next("", twt.Created)); err != nil {
+			return fmt.Errorf("error writing feed %s: %w", name, err)
+		}
+	}
+
+	if err := commitBot(bot); err != nil {
+		return err
+	}
+
+	conf.NotifyFeedUpdated(name)
+
+	return nil
+}
+
+// commitBot saves the state of the last run of the `bot` if it is a
+// StatefulBot.
+func commitBot(bot Bot) error {
+	if b, ok := bot.(StatefulBot); ok {
+		if err := b.Commit(); err != nil {
+			return fmt.Errorf("error saving state of bot %s: %w", bot.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBot struct {
+	name string
+	twts []Twt
+}
+
+func (bot *testBot) Name() string        { return bot.name }
+func (bot *testBot) Description() string { return "a test bot" }
+func (bot *testBot) Schedule() string    { return "@hourly" }
+
+func (bot *testBot) Generate(ctx context.Context, now time.Time) ([]Twt, error) {
+	return bot.twts, nil
+}
+
+func TestNewBots(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	RegisterBot("test", func(conf *Config, name string, feed *Feed) (Bot, error) {
+		return &testBot{name: name}, nil
+	}, false)
+	defer delete(botKinds, "test")
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.FeedsFile = filepath.Join(conf.DataDir, "feeds.yaml")
+	conf.Feeds["first"] = &Feed{Name: "first", Type: FeedTypeBot, Bot: &FeedBot{Kind: "test"}, Schedule: "@daily"}
+	conf.Feeds["second"] = &Feed{Name: "second", Type: FeedTypeBot, Bot: &FeedBot{Kind: "test", Disabled: true}}
+
+	bots, err := NewBots(conf)
+	require.NoError(err)
+	assert.Equal([]string{"first", "tiktok"}, BotNames(bots))
+
+	assert.Equal("@daily", BotSchedule(conf, bots["first"]))
+	assert.Equal("0 0,30 * * * *", BotSchedule(conf, bots["tiktok"]))
+	assert.Equal("", conf.Feeds["first"].Description)
+	assert.Equal(FeedTypeBot, conf.Feeds["tiktok"].Type)
+	assert.Contains(conf.Feeds["tiktok"].Description, "every 30m")
+
+	// The feeds of builtin bots are not saved.
+	require.NoError(conf.SaveFeeds())
+	saved := NewConfig()
+	saved.FeedsFile = conf.FeedsFile
+	require.NoError(saved.LoadFeeds())
+	assert.Contains(saved.Feeds, "first")
+	assert.NotContains(saved.Feeds, "tiktok")
+
+	// Builtin bots are run again (once) and do not take over other feeds.
+	bots, err = NewBots(conf)
+	require.NoError(err)
+	assert.Equal([]string{"first", "tiktok"}, BotNames(bots))
+
+	conf.Feeds["tiktok"] = &Feed{Name: "tiktok", Type: FeedTypeRSS, URI: "https://example.com/rss.xml"}
+	bots, err = NewBots(conf)
+	require.NoError(err)
+	assert.Equal([]string{"first"}, BotNames(bots))
+	assert.Equal(FeedTypeRSS, conf.Feeds["tiktok"].Type)
+	assert.Equal("", conf.Feeds["tiktok"].Description)
+
+	conf.Feeds["tiktok"] = &Feed{Name: "tiktok", Type: FeedTypeBot, Bot: &FeedBot{Disabled: true}}
+	bots, err = NewBots(conf)
+	require.NoError(err)
+	assert.Equal([]string{"first"}, BotNames(bots))
+
+	conf.Feeds["third"] = &Feed{Name: "third", Type: FeedTypeBot}
+	_, err = NewBots(conf)
+	assert.Error(err)
+}
+
+func TestRunBot(t *testing.T) {
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	bot := &testBot{name: "test", twts: []Twt{{Created: now, Text: "Hello"}, {Created: now, Text: "World"}}}
+	require.NoError(t, RunBot(conf, bot, now))
+	require.NoError(t, RunBot(conf, bot, now))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "test.txt"))
+	require.NoError(t, err)
+	require.Len(t, twts, 4)
+	assert.Equal(t, now.Add(3*time.Second), twts[3].Created)
+}
+
+func TestTikTokBot(t *testing.T) {
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+
+	bot, err := NewTikTokBot(conf, "tiktok", &Feed{})
+	require.NoError(t, err)
+
+	for expected, now := range map[string]time.Time{
+		"🕛 The time is now twelve o'clock in the morning 😴":  time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		"🕤 The time is now nine thirty 🌞":                    time.Date(2021, 1, 1, 9, 30, 0, 0, time.UTC),
+		"🕒 The time is now three o'clock in the afternoon 🌅": time.Date(2021, 1, 1, 15, 0, 0, 0, time.UTC),
+		"🕥 The time is now ten thirty in the evening 🌛":      time.Date(2021, 1, 1, 22, 30, 0, 0, time.UTC),
+	} {
+		twts, err := bot.Generate(context.Background(), now)
+		require.NoError(t, err)
+		require.Len(t, twts, 1)
+		assert.Equal(t, expected, twts[0].Text)
+	}
+
+	// Its feed only holds the current time.
+	require.NoError(t, RunBot(conf, bot, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)))
+	require.NoError(t, RunBot(conf, bot, time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)))
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "tiktok.txt"))
+	require.NoError(t, err)
+	require.Len(t, twts, 1)
+	assert.Equal(t, "🕧 The time is now twelve thirty in the morning 😴", twts[0].Text)
+}
@@ -19,8 +19,22 @@ type Config struct {
 	BaseURL     string
 	FeedsFile   string
 	MaxFeedSize int64 // maximum feed size before rotating
+	WebSub      bool  // subscribe to feeds' WebSub hubs for push updates
+	Backfill    int   // number of items new feeds are backfilled with (0 for all)
+	MaxItems    int   // maximum number of items emitted per update (0 for no limit)
 
 	Feeds map[string]*Feed // name -> url
+
+	hub *Hub // publishes updated feeds to WebSub subscribers, if any
+}
+
+// NotifyFeedUpdated notifies the subscribers of the feed `name`, if any, that
+// new twts were appended to it.
+func (conf *Config) NotifyFeedUpdated(name string) {
+	if conf.hub == nil {
+		return
+	}
+	conf.hub.Publish(name)
 }
 
 func (conf *Config) LoadFeeds() error {
@@ -42,10 +56,31 @@ func (conf *Config) LoadFeeds() error {
 		return fmt.Errorf("error parsing feeds file %s: %w", conf.FeedsFile, err)
 	}
 
-	for _, feed := range conf.Feeds {
+	for name, feed := range conf.Feeds {
 		if feed == nil {
 			continue
 		}
+
+		if err := loadFeedMeta(conf, name, feed); err != nil {
+			log.WithError(err).Warnf("error loading metadata of feed %s", name)
+		}
+
+		if err := loadWebSub(conf, name, feed); err != nil {
+			log.WithError(err).Warnf("error loading websub subscription of feed %s", name)
+		}
+
+		if err := feed.Filters.Compile(); err != nil {
+			log.WithError(err).Errorf("error in filters of feed %s", name)
+			return fmt.Errorf("error in filters of feed %s: %w", name, err)
+		}
+
+		if err := feed.CompileTemplate(); err != nil {
+			log.WithError(err).Errorf("error in template of feed %s", name)
+			return fmt.Errorf("error in template of feed %s: %w", name, err)
+		}
+
+		feed.CompileConverter()
+
 		fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.png", feed.Name))
 		if !Exists(fn) {
 			continue
@@ -87,7 +122,15 @@ func (conf *Config) SaveFeeds() error {
 	}
 	defer f.Close()
 
-	data, err := yaml.Marshal(conf.Feeds)
+	feeds := make(map[string]*Feed)
+	for name, feed := range conf.Feeds {
+		if feed != nil && feed.builtin {
+			continue
+		}
+		feeds[name] = feed
+	}
+
+	data, err := yaml.Marshal(feeds)
 	if err != nil {
 		log.WithError(err).Errorf("error serializing feeds")
 		return fmt.Errorf("error serializing feeds: %w", err)
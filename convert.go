@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// boilerplateSelector selects elements that are never part of an item's
+// content, scripts, embeds and share buttons and the like.
+const boilerplateSelector = `script, style, noscript, form, button, object, embed,
+.sharedaddy, .sd-sharing, .share, .sharing, .share-buttons, .social-share,
+.feedflare, .jp-relatedposts, .addtoany_share_save_container, .a2a_kit`
+
+// blockSelector selects elements separated by newlines in plain text.
+const blockSelector = `p, div, br, li, h1, h2, h3, h4, h5, h6, blockquote, pre, tr, hr`
+
+// trackers are substrings of the URLs of known tracking images.
+var trackers = []string{
+	"feeds.feedburner.com/~r/",
+	"feeds.feedburner.com/~ff/",
+	"feedsportal.com",
+	"stats.wordpress.com",
+	"pixel.wp.com",
+	"doubleclick.net",
+	"google-analytics.com",
+}
+
+// trackerSegments are path segments of the URLs of known tracking images.
+var trackerSegments = []string{"tracking", "pixel"}
+
+// trackingParams are query parameters used for tracking.
+var trackingParams = regexp.MustCompile(`^(utm_.*|fbclid|gclid|mc_cid|mc_eid|_hsenc|_hsmi)$`)
+
+var (
+	blankLines   = regexp.MustCompile(`\n{3,}`)
+	youtubeEmbed = regexp.MustCompile(`^https?://(?:www\.)?youtube(?:-nocookie)?\.com/embed/([\w-]+)`)
+	vimeoEmbed   = regexp.MustCompile(`^https?://player\.vimeo\.com/video/(\d+)`)
+)
+
+// ConverterOptions configure the conversion of a feed's HTML content.
+type ConverterOptions struct {
+	// PlainText converts content to plain text instead of Markdown
+	PlainText bool `yaml:"plain_text,omitempty"`
+
+	// KeepTrackingParams keeps tracking (utm_*, ...) query parameters of links
+	KeepTrackingParams bool `yaml:"keep_tracking_params,omitempty"`
+
+	// Remove are further CSS selectors of boilerplate to remove
+	Remove []string `yaml:"remove,omitempty"`
+}
+
+// Converter converts HTML content into Markdown (or plain text), dropping
+// tracking images and boilerplate and resolving relative links. A Converter
+// is safe to be reused.
+type Converter struct {
+	opts ConverterOptions
+	md   *md.Converter
+}
+
+var defaultConverter = NewConverter(nil)
+
+// NewConverter returns a new converter with the options `opts` (or the
+// defaults if nil).
+func NewConverter(opts *ConverterOptions) *Converter {
+	converter := &Converter{md: md.NewConverter("", true, nil)}
+	if opts != nil {
+		converter.opts = *opts
+	}
+	return converter
+}
+
+// CompileConverter builds the converter of the feed's content from its
+// conversion options, if any.
+func (feed *Feed) CompileConverter() {
+	feed.converter = nil
+	if feed.Conversion != nil {
+		feed.converter = NewConverter(feed.Conversion)
+	}
+}
+
+// Converter returns the converter of the feed's content, built by
+// CompileConverter when the feed was loaded (or afresh if it was not).
+func (feed *Feed) Converter() *Converter {
+	if feed == nil || feed.Conversion == nil {
+		return defaultConverter
+	}
+	if feed.converter == nil {
+		return NewConverter(feed.Conversion)
+	}
+	return feed.converter
+}
+
+// PlainText returns true if the converter converts content to plain text.
+func (c *Converter) PlainText() bool {
+	return c.opts.PlainText
+}
+
+// Convert converts the HTML `content` of an item whose links are relative to
+// the item's link `base`.
+func (c *Converter) Convert(content, base string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	c.clean(doc, base)
+
+	if c.opts.PlainText {
+		return plainText(doc), nil
+	}
+
+	return c.md.Convert(doc.Selection), nil
+}
+
+func (c *Converter) clean(doc *goquery.Document, base string) {
+	baseURL, _ := url.Parse(base)
+
+	doc.Find(boilerplateSelector).Remove()
+	for _, selector := range c.opts.Remove {
+		doc.Find(selector).Remove()
+	}
+
+	// Embedded videos are linked to, other iframes are dropped.
+	doc.Find("iframe").Each(func(_ int, s *goquery.Selection) {
+		src := c.resolve(baseURL, s.AttrOr("src", ""))
+		var link string
+		if match := youtubeEmbed.FindStringSubmatch(src); match != nil {
+			link = "https://www.youtube.com/watch?v=" + match[1]
+		} else if match := vimeoEmbed.FindStringSubmatch(src); match != nil {
+			link = "https://vimeo.com/" + match[1]
+		}
+
+		if link == "" {
+			s.Remove()
+			return
+		}
+		link = html.EscapeString(link)
+		s.ReplaceWithHtml(fmt.Sprintf(`<a href="%s">%s</a>`, link, link))
+	})
+
+	doc.Find("img").Each(func(_ int, s *goquery.Selection) {
+		src := s.AttrOr("src", "")
+		if isTrackingImage(s, src) {
+			s.Remove()
+			return
+		}
+		s.SetAttr("src", c.resolve(baseURL, src))
+	})
+
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		s.SetAttr("href", c.resolve(baseURL, s.AttrOr("href", "")))
+	})
+}
+
+// resolve resolves the `ref` against the `base` URL and strips tracking
+// query parameters.
+func (c *Converter) resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || u.Scheme == "data" || u.Scheme == "mailto" {
+		return ref
+	}
+
+	if base != nil && base.IsAbs() {
+		u = base.ResolveReference(u)
+	}
+
+	// The query is only rewritten if tracking parameters are removed, as
+	// rewriting it reorders and re-escapes it, which breaks signed URLs.
+	if !c.opts.KeepTrackingParams && u.RawQuery != "" {
+		query := u.Query()
+		removed := false
+		for key := range query {
+			if trackingParams.MatchString(key) {
+				query.Del(key)
+				removed = true
+			}
+		}
+		if removed {
+			u.RawQuery = query.Encode()
+		}
+	}
+
+	return u.String()
+}
+
+func isTrackingImage(s *goquery.Selection, src string) bool {
+	if s.AttrOr("width", "") == "1" || s.AttrOr("height", "") == "1" ||
+		s.AttrOr("width", "") == "0" || s.AttrOr("height", "") == "0" {
+		return true
+	}
+
+	for _, tracker := range trackers {
+		if strings.Contains(src, tracker) {
+			return true
+		}
+	}
+
+	if u, err := url.Parse(src); err == nil {
+		for _, segment := range strings.Split(u.Path, "/") {
+			for _, tracker := range trackerSegments {
+				if segment == tracker {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// plainText returns the text of the `doc` with its blocks on lines of their
+// own.
+func plainText(doc *goquery.Document) string {
+	doc.Find("img, picture, video, audio, svg").Remove()
+	doc.Find(blockSelector).Each(func(_ int, s *goquery.Selection) {
+		s.AfterHtml("\n")
+	})
+
+	var lines []string
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
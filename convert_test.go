@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const convertContent = `<p>Hello <a href="/about?utm_source=rss&amp;id=1">world</a>!</p>
+<img src="images/cat.png" alt="cat">
+<img src="https://feeds.feedburner.com/~r/example/~4/abc" alt="">
+<img src="https://example.com/beacon.gif" width="1" height="1">
+<img src="https://t.example.com/pixel/open.gif?id=1" alt="">
+<img src="/pixelart/x.png" alt="art">
+<iframe src="https://www.youtube.com/embed/dQw4w9WgXcQ"></iframe>
+<iframe src="https://ads.example.com/banner"></iframe>
+<div class="sharedaddy"><a href="https://twitter.com/share">Share</a></div>
+<div class="related">Related posts</div>
+<script>track()</script>`
+
+func TestConverter(t *testing.T) {
+	markdown, err := NewConverter(nil).Convert(convertContent, "https://example.com/posts/1")
+	require.NoError(t, err)
+
+	assert.Contains(t, markdown, "Hello [world](https://example.com/about?id=1)!")
+	assert.Contains(t, markdown, "![cat](https://example.com/posts/images/cat.png)")
+	assert.Contains(t, markdown, "[https://www.youtube.com/watch?v=dQw4w9WgXcQ](https://www.youtube.com/watch?v=dQw4w9WgXcQ)")
+	assert.Contains(t, markdown, "![art](https://example.com/pixelart/x.png)")
+	assert.Contains(t, markdown, "Related posts")
+	assert.NotContains(t, markdown, "feedburner")
+	assert.NotContains(t, markdown, "open.gif")
+	assert.NotContains(t, markdown, "beacon")
+	assert.NotContains(t, markdown, "ads.example.com")
+	assert.NotContains(t, markdown, "Share")
+	assert.NotContains(t, markdown, "track()")
+
+	// Queries without tracking parameters are left as they are.
+	markdown, err = NewConverter(nil).Convert(`<a href="https://cdn.example.com/f.pdf?z=1&a=b%2Fc&sig=x">signed</a>`, "")
+	require.NoError(t, err)
+	assert.Equal(t, "[signed](https://cdn.example.com/f.pdf?z=1&a=b%2Fc&sig=x)", markdown)
+}
+
+func TestConverterOptions(t *testing.T) {
+	converter := NewConverter(&ConverterOptions{
+		PlainText:          true,
+		KeepTrackingParams: true,
+		Remove:             []string{".related"},
+	})
+
+	text, err := converter.Convert(convertContent, "https://example.com/posts/1")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world!\n\nhttps://www.youtube.com/watch?v=dQw4w9WgXcQ", text)
+
+	markdown, err := NewConverter(&ConverterOptions{KeepTrackingParams: true}).Convert(convertContent, "")
+	require.NoError(t, err)
+	assert.Contains(t, markdown, "[world](/about?utm_source=rss&id=1)")
+}
+
+func TestFeedConverter(t *testing.T) {
+	conf := NewConfig()
+	conf.Feeds["example"] = &Feed{
+		Name:       "example",
+		Conversion: &ConverterOptions{PlainText: true},
+	}
+
+	item := &gofeed.Item{
+		Title:       "Greetings",
+		Description: "<p><em>Hello</em> <a href=\"/world\">world</a></p>",
+		Link:        "https://example.com/hello",
+	}
+
+	text, err := FormatItem(conf, "example", item)
+	require.NoError(t, err)
+	assert.Equal(t, "Greetings\u2028Hello world ⌘ [Read more](https://example.com/hello)", text)
+
+	assert.Same(t, defaultConverter, (&Feed{}).Converter())
+}
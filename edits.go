@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// editTemplate is the text of a twt propagating an upstream edit of an item
+// as a reply to its original twt.
+const editTemplate = "(#%s) ✏️ Updated: %s"
+
+// itemState is what is remembered about a written item of a feed that
+// propagates edits, the hash of its original twt and its upstream revision.
+type itemState struct {
+	Hash    string    `json:"hash"`
+	Updated time.Time `json:"updated,omitempty"`
+	Digest  string    `json:"digest"`
+}
+
+// itemKey returns the key identifying the `item` across updates.
+func itemKey(item *gofeed.Item) string {
+	switch {
+	case item.GUID != "":
+		return item.GUID
+	case item.Link != "":
+		return item.Link
+	default:
+		return item.Title
+	}
+}
+
+// itemDigest returns a digest of the `item`'s content to detect edits by.
+func itemDigest(item *gofeed.Item) string {
+	return FastHashString(fmt.Sprintf("%s\n%s\n%s", item.Title, item.Description, item.Content))
+}
+
+func newItemState(hash string, item *gofeed.Item) *itemState {
+	state := &itemState{Hash: hash, Digest: itemDigest(item)}
+	if item.UpdatedParsed != nil {
+		state.Updated = *item.UpdatedParsed
+	}
+	return state
+}
+
+// edited returns true if the `item` was updated upstream since the state.
+func (state *itemState) edited(item *gofeed.Item) bool {
+	if item.UpdatedParsed != nil && item.UpdatedParsed.After(state.Updated) && !state.Updated.IsZero() {
+		return true
+	}
+	return itemDigest(item) != state.Digest
+}
+
+// WriteItemEdits appends a twt replying to the original twt of each of the
+// already written `items` of the feed `name` that was edited upstream since.
+// The state of items no longer in the upstream feed is pruned.
+func WriteItemEdits(conf *Config, name string, items []*gofeed.Item) error {
+	states := make(map[string]*itemState)
+	if err := LoadState(conf, name, "items", &states); err != nil {
+		return err
+	}
+
+	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name))
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ts, err := LoadTimestamps(conf, name)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	mentions := NewMentions(conf)
+	seen := make(map[string]bool)
+	new := 0
+
+	for _, item := range items {
+		key := itemKey(item)
+		seen[key] = true
+
+		state, ok := states[key]
+		if !ok || !state.edited(item) {
+			continue
+		}
+
+		prefix := fmt.Sprintf(editTemplate, state.Hash, "")
+		text, err := formatItem(conf, mentions, name, item, maxTwtLength-len([]rune(prefix)))
+		if err != nil {
+			return err
+		}
+
+		if err := AppendTwt(f, fmt.Sprintf(editTemplate, state.Hash, text), ts.Next("", now)); err != nil {
+			return err
+		}
+		new++
+
+		log.WithField("name", name).Infof("propagated edit of %q", item.Title)
+
+		states[key] = newItemState(state.Hash, item)
+	}
+
+	for key := range states {
+		if !seen[key] {
+			delete(states, key)
+		}
+	}
+
+	if new > 0 {
+		conf.NotifyFeedUpdated(name)
+	}
+
+	return SaveState(conf, name, "items", states)
+}
+
+// recordItems remembers the twts the `items` of the feed `name` were written
+// as, by their twt hashes, to propagate later edits of them.
+func recordItems(conf *Config, name string, items map[string]*itemState) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	states := make(map[string]*itemState)
+	if err := LoadState(conf, name, "items", &states); err != nil {
+		return err
+	}
+
+	for key, state := range items {
+		states[key] = state
+	}
+
+	return SaveState(conf, name, "items", states)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwtHash(t *testing.T) {
+	created := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	hash := TwtHash("https://example.com/twtxt.txt", created, "Hello World")
+	assert.Len(t, hash, twtHashLength)
+	assert.Equal(t, strings.ToLower(hash), hash)
+
+	// The timestamp is normalized to UTC.
+	assert.Equal(t, hash, TwtHash("https://example.com/twtxt.txt", created.In(time.FixedZone("NZDT", 13*3600)), "Hello World"))
+	assert.Equal(t, hash, Twt{Created: created, Text: "Hello World"}.Hash("https://example.com/twtxt.txt"))
+
+	assert.NotEqual(t, hash, TwtHash("https://example.com/twtxt.txt", created, "Hello World!"))
+	assert.NotEqual(t, hash, TwtHash("https://example.org/twtxt.txt", created, "Hello World"))
+	assert.NotEqual(t, hash, TwtHash("https://example.com/twtxt.txt", created.Add(time.Second), "Hello World"))
+}
+
+func TestWriteItemEdits(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["example"] = &Feed{Name: "example", Edits: true}
+
+	published := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	updated := published
+	item := &gofeed.Item{
+		GUID:            "1",
+		Title:           "Hello",
+		Description:     "Helo World",
+		Link:            "https://example.com/hello",
+		PublishedParsed: &published,
+		UpdatedParsed:   &updated,
+	}
+	other := &gofeed.Item{GUID: "2", Title: "Other", PublishedParsed: &published}
+
+	fn := filepath.Join(conf.DataDir, "example.txt")
+
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", []*gofeed.Item{item, other}))
+	twts, err := ReadTwts(fn)
+	require.NoError(err)
+	require.Len(twts, 2)
+	hash := twts[0].Hash(URLForFeed(conf, "example"))
+
+	// Nothing changed.
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", []*gofeed.Item{item, other}))
+	twts, err = ReadTwts(fn)
+	require.NoError(err)
+	assert.Len(twts, 2)
+
+	// The content was corrected.
+	edited := *item
+	edited.Description = "Hello World"
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", []*gofeed.Item{&edited}))
+	twts, err = ReadTwts(fn)
+	require.NoError(err)
+	require.Len(twts, 3)
+	assert.Equal("(#"+hash+") ✏️ Updated: **Hello**\u2028Hello World ⌘ [Read more](https://example.com/hello)", twts[2].Text)
+
+	// Only the updated date changed, edits still reply to the original twt.
+	later := updated.Add(time.Hour)
+	edited.UpdatedParsed = &later
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", []*gofeed.Item{&edited}))
+	twts, err = ReadTwts(fn)
+	require.NoError(err)
+	require.Len(twts, 4)
+	assert.True(strings.HasPrefix(twts[3].Text, "(#"+hash+") "))
+
+	// Items no longer upstream are forgotten.
+	states := make(map[string]*itemState)
+	require.NoError(LoadState(conf, "example", "items", &states))
+	assert.Len(states, 1)
+	assert.Contains(states, "1")
+}
+
+func TestWriteItemEditsDisabled(t *testing.T) {
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.Feeds["example"] = &Feed{Name: "example"}
+
+	published := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	item := &gofeed.Item{GUID: "1", Title: "Hello", Description: "Helo", PublishedParsed: &published}
+	require.NoError(t, AppendFeedItems(conf, "example", "https://example.com/rss.xml", []*gofeed.Item{item}))
+
+	item.Description = "Hello"
+	require.NoError(t, AppendFeedItems(conf, "example", "https://example.com/rss.xml", []*gofeed.Item{item}))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "example.txt"))
+	require.NoError(t, err)
+	assert.Len(t, twts, 1)
+	assert.False(t, Exists(StateFile(conf, "example", "items")))
+}
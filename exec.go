@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// execDefaultTimeout is how long a command may run for unless the feed
+	// configures its own `timeout`
+	execDefaultTimeout = time.Minute
+
+	// execMaxOutput is the maximum output of a command we consider
+	execMaxOutput = 1 << 20 // 1MB
+
+	// execMaxSeen is the number of item ids remembered to detect new items
+	execMaxSeen = 1000
+
+	// execPath is the only PATH commands are run with
+	execPath = "/usr/local/bin:/usr/bin:/bin"
+)
+
+var (
+	ErrExecTimeout = errors.New("error: command timed out")
+)
+
+// ExecItem is an item printed by a command as a single line of JSON.
+type ExecItem struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Text       string   `json:"text"`
+	Link       string   `json:"link"`
+	Time       string   `json:"time"`
+	Author     string   `json:"author"`
+	Categories []string `json:"categories"`
+}
+
+// execState is the state kept between runs of a command to detect new items.
+type execState struct {
+	Seen []string `json:"seen"`
+}
+
+// limitedBuffer is a buffer that silently discards anything written past its
+// limit so a runaway command cannot exhaust our memory.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		if room < 0 {
+			room = 0
+		}
+		p = p[:room]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+// ExecCommand returns the command and arguments of an `exec://` source.
+func ExecCommand(uri string) ([]string, error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Type != "exec" {
+		return nil, fmt.Errorf("error: not an exec uri %q", uri)
+	}
+
+	args := strings.Fields(u.Rest)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("error: no command in exec uri %q", uri)
+	}
+
+	if !filepath.IsAbs(args[0]) {
+		return nil, fmt.Errorf("error: exec command %q must be an absolute path", args[0])
+	}
+
+	return args, nil
+}
+
+// RunExecCommand runs the command of the `exec://` source of the feed `name`
+// in a sandboxed environment, a fresh empty working directory and a minimal
+// environment, and returns its output.
+func RunExecCommand(conf *Config, name, uri string) ([]byte, error) {
+	args, err := ExecCommand(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := execDefaultTimeout
+	env := map[string]string{}
+	if feed := conf.Feeds[name]; feed != nil {
+		if feed.Timeout != "" {
+			if timeout, err = time.ParseDuration(feed.Timeout); err != nil {
+				return nil, fmt.Errorf("error parsing timeout %q: %w", feed.Timeout, err)
+			}
+		}
+		for k, v := range feed.Env {
+			env[k] = v
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "feeds-exec-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env["PATH"] = execPath
+	env["HOME"] = dir
+	env["TMPDIR"] = dir
+	env["LANG"] = "C.UTF-8"
+	env["FEEDS_NAME"] = name
+	env["FEEDS_URL"] = URLForFeed(conf, name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.WaitDelay = time.Second
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(cmd.Env)
+
+	stdout := &limitedBuffer{limit: execMaxOutput}
+	stderr := &limitedBuffer{limit: execMaxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrExecTimeout
+		}
+		return nil, fmt.Errorf("error running %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	if stdout.truncated {
+		log.Warnf("output of %s for %s truncated to %d bytes", args[0], name, execMaxOutput)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// ParseExecOutput parses the output of a command, one JSON item or twtxt
+// formatted twt per line, into feed items and twts. JSON items without a
+// `time` are stamped with `now`.
+func ParseExecOutput(output []byte, now time.Time) ([]*gofeed.Item, []Twt) {
+	var (
+		items []*gofeed.Item
+		lines []string
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), execMaxOutput)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "{") {
+			lines = append(lines, line)
+			continue
+		}
+
+		var execItem ExecItem
+		if err := json.Unmarshal([]byte(line), &execItem); err != nil {
+			log.WithError(err).Warnf("error parsing exec item %q", line)
+			continue
+		}
+
+		item := &gofeed.Item{
+			GUID:        execItem.ID,
+			Title:       execItem.Title,
+			Description: execItem.Content,
+			Link:        execItem.Link,
+			Categories:  execItem.Categories,
+		}
+		if item.Description == "" {
+			item.Description = execItem.Text
+		}
+		if item.GUID == "" {
+			item.GUID = FastHashString(line)
+		}
+		if execItem.Author != "" {
+			item.Author = &gofeed.Person{Name: execItem.Author}
+		}
+
+		published := now
+		if execItem.Time != "" {
+			t, err := ParseTimestamp(execItem.Time)
+			if err != nil {
+				log.WithError(err).Warnf("error parsing exec item time %q", execItem.Time)
+			} else {
+				published = t
+			}
+		}
+		item.PublishedParsed = &published
+
+		items = append(items, item)
+	}
+
+	twtxt, _ := ParseTwtxt(strings.NewReader(strings.Join(lines, "\n")))
+
+	return items, twtxt.Twts
+}
+
+// UpdateExecFeed runs the command of the `exec://` source `uri` and appends
+// any new items it prints to the feed `name`.
+func UpdateExecFeed(conf *Config, name, uri string) error {
+	output, err := RunExecCommand(conf, name, uri)
+	if err != nil {
+		return err
+	}
+
+	items, twts := ParseExecOutput(output, time.Now())
+
+	var state execState
+	if err := LoadState(conf, name, "exec", &state); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range state.Seen {
+		seen[id] = true
+	}
+
+	var newItems []*gofeed.Item
+	for _, item := range items {
+		if seen[item.GUID] {
+			continue
+		}
+		seen[item.GUID] = true
+		state.Seen = append(state.Seen, item.GUID)
+		newItems = append(newItems, item)
+	}
+	if len(state.Seen) > execMaxSeen {
+		state.Seen = state.Seen[len(state.Seen)-execMaxSeen:]
+	}
+
+	if len(newItems) > 0 {
+		if err := WriteFeedItems(conf, name, newItems); err != nil {
+			return err
+		}
+	}
+
+	if len(twts) > 0 {
+		if err := AppendNewTwts(conf, name, twts); err != nil {
+			return err
+		}
+	}
+
+	return SaveState(conf, name, "exec", state)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestScript(t *testing.T, script string) string {
+	fn := filepath.Join(t.TempDir(), "script.sh")
+	require.NoError(t, os.WriteFile(fn, []byte("#!/bin/sh\n"+script), 0755))
+	return fn
+}
+
+func TestParseExecOutput(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	output := strings.Join([]string{
+		`{"id": "1", "title": "Build #1", "text": "passed", "link": "https://ci.example.com/1"}`,
+		`{"title": "Build #2", "content": "<b>failed</b>", "time": "2021-01-01T10:00:00Z"}`,
+		`{not json`,
+		"2021-01-01T11:00:00Z\tA plain twt",
+		"some noise",
+	}, "\n")
+
+	items, twts := ParseExecOutput([]byte(output), now)
+	require.Len(items, 2)
+	assert.Equal("1", items[0].GUID)
+	assert.Equal("passed", items[0].Description)
+	assert.Equal(now, *items[0].PublishedParsed)
+	assert.NotEmpty(items[1].GUID)
+	assert.Equal("<b>failed</b>", items[1].Description)
+	assert.Equal(10, items[1].PublishedParsed.Hour())
+
+	require.Len(twts, 1)
+	assert.Equal("A plain twt", twts[0].Text)
+}
+
+func TestUpdateExecFeed(t *testing.T) {
+	t.Run("appends new items only once", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		script := writeTestScript(t, `echo '{"id": "build-1", "title": "Build #1", "text": "passed"}'`)
+
+		conf := NewConfig()
+		conf.DataDir = t.TempDir()
+		uri := "exec://" + script
+
+		require.NoError(UpdateExecFeed(conf, "ci", uri))
+		require.NoError(UpdateExecFeed(conf, "ci", uri))
+
+		twts, err := ReadTwts(filepath.Join(conf.DataDir, "ci.txt"))
+		require.NoError(err)
+		require.Len(twts, 1)
+		assert.Equal("**Build #1**\u2028passed", twts[0].Text)
+	})
+
+	t.Run("runs in a sandboxed environment", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		os.Setenv("FEEDS_TEST_SECRET", "hunter2")
+		defer os.Unsetenv("FEEDS_TEST_SECRET")
+
+		script := writeTestScript(t, `echo "$FEEDS_TEST_SECRET|$EXTRA|$FEEDS_NAME|$(pwd)|$(ls -A | wc -l)"`)
+
+		conf := NewConfig()
+		conf.Feeds["env"] = &Feed{Name: "env", Env: map[string]string{"EXTRA": "extra"}}
+
+		output, err := RunExecCommand(conf, "env", "exec://"+script)
+		require.NoError(err)
+
+		fields := strings.Split(strings.TrimSpace(string(output)), "|")
+		require.Len(fields, 5)
+		assert.Equal("", fields[0])
+		assert.Equal("extra", fields[1])
+		assert.Equal("env", fields[2])
+		assert.NotEqual(filepath.Dir(script), fields[3])
+		assert.Equal("0", strings.TrimSpace(fields[4]))
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		script := writeTestScript(t, "sleep 5\n")
+
+		conf := NewConfig()
+		conf.Feeds["slow"] = &Feed{Name: "slow", Timeout: "100ms"}
+
+		_, err := RunExecCommand(conf, "slow", "exec://"+script)
+		assert.ErrorIs(t, err, ErrExecTimeout)
+	})
+
+	t.Run("requires an absolute command", func(t *testing.T) {
+		_, err := ExecCommand("exec://script.sh")
+		assert.Error(t, err)
+	})
+}
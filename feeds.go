@@ -1,16 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
 	"time"
 
-	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/andyleap/microformats"
 	"github.com/gosimple/slug"
 	"github.com/mmcdole/gofeed"
@@ -19,18 +22,29 @@ import (
 
 const (
 	avatarResolution = 60 // 60x60 px
-	twtxtTemplate    = "%s\t%s ⌘ [Read more](%s)\n"
+	twtxtTemplate    = "%s\t%s\n"
 	maxTwtLength     = 576
 	maxTweets        = 10
+
+	maxFeedDocumentSize = 1 << 23 // 8MB
 )
 
 var (
 	ErrNoSuitableFeedsFound = errors.New("error: no suitable RSS or Atom feeds found")
 )
 
+// ItemFormat is the key of an item's `Custom` data holding the format of its
+// content when this is not HTML.
+const (
+	ItemFormat         = "format"
+	ItemFormatMarkdown = "markdown"
+)
+
 const (
-	FeedTypeRSS = "rss"
-	FeedTypeBot = "bot"
+	FeedTypeRSS    = "rss"
+	FeedTypeBot    = "bot"
+	FeedTypeTwtxt  = "twtxt"
+	FeedTypeGemini = "gemini"
 )
 
 // Feed ...
@@ -43,21 +57,115 @@ type Feed struct {
 	Description string
 
 	LastModified string
+
+	// Link, Lang, Refresh and Follow are further preamble metadata, the
+	// upstream homepage and language, the interval (in seconds) clients
+	// should poll at and the feeds followed (as `nick url`)
+	Link    string   `yaml:"link,omitempty"`
+	Lang    string   `yaml:"lang,omitempty"`
+	Refresh int      `yaml:"refresh,omitempty"`
+	Follow  []string `yaml:"follow,omitempty"`
+
+	// Sources are further upstream feeds merged into this one (twtxt only)
+	Sources []string `yaml:"sources,omitempty"`
+
+	// Schedule is a cron spec to update this feed on instead of the default
+	// (or to run its bot on)
+	Schedule string `yaml:"schedule,omitempty"`
+
+	// Bot configures the bot generating the feed (bot only)
+	Bot *FeedBot `yaml:"bot,omitempty"`
+
+	// builtin is set on the feeds of builtin bots not declared, which are
+	// not saved
+	builtin bool
+
+	// Timeout and Env are the timeout and extra environment of commands (exec only)
+	Timeout string            `yaml:"timeout,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+
+	// Filters are rules to include/exclude items by
+	Filters *FeedFilters `yaml:"filters,omitempty"`
+
+	// Template is a text/template to render items as twts with
+	Template string `yaml:"template,omitempty"`
+
+	// Languages are the only languages of items written, if any
+	Languages []string `yaml:"languages,omitempty"`
+
+	// Hashtags configures the hashtags generated from item categories
+	Hashtags *FeedHashtags `yaml:"hashtags,omitempty"`
+
+	// Edits propagates upstream edits of items as replies to their twts
+	Edits bool `yaml:"edits,omitempty"`
+
+	// Identities are further URLs and handles of the source to mention it by
+	Identities []string `yaml:"identities,omitempty"`
+
+	// MirrorMedia mirrors the images of items instead of linking to them
+	MirrorMedia bool `yaml:"mirror_media,omitempty"`
+
+	// Conversion configures how the feed's HTML content is converted
+	Conversion *ConverterOptions `yaml:"conversion,omitempty"`
+
+	// Readability replaces the content of items with the article they link to
+	Readability bool `yaml:"readability,omitempty"`
+
+	// Thread is the most twts a long item is threaded into (disabled if < 2)
+	Thread int `yaml:"thread,omitempty"`
+
+	// Backfill is the number of items the feed is initially backfilled with
+	// overriding the default, all of its history if negative
+	Backfill int `yaml:"backfill,omitempty"`
+
+	template  *template.Template
+	converter *Converter
+	webSub    *WebSubSubscription // the subscription to the feed's WebSub hub, if any
+	backfill  int                 // number of items being explicitly backfilled, if any
+}
+
+// UpdateFeed updates the feed `name` from its upstream source `uri`
+// dispatching on the type of source.
+func UpdateFeed(conf *Config, name, uri string) error {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return err
+	}
+
+	switch u.Type {
+	case "rss", "http", "https":
+		return UpdateRSSFeed(conf, name, uri)
+	case "twtxt":
+		return UpdateTwtxtFeed(conf, name, uri)
+	case "gemini":
+		return UpdateGeminiFeed(conf, name, uri)
+	case "exec":
+		return UpdateExecFeed(conf, name, uri)
+	case "file":
+		return UpdateFileFeed(conf, name, uri)
+	case "maildir", "imap", "imaps":
+		return UpdateMailFeed(conf, name, uri)
+	default:
+		return fmt.Errorf("error: unknown feed type %q", u.Type)
+	}
 }
 
 func ProcessFeedContent(title, desc string, max int) string {
-	converter := md.NewConverter("", true, nil)
-	markdown, err := converter.ConvertString(desc)
+	markdown, err := defaultConverter.Convert(desc, "")
 	if err != nil {
 		log.WithError(err).Warnf("error converting content to html")
 		return fmt.Sprintf("%s: %s", title, err)
 	}
-	markdown = CleanTwt(fmt.Sprintf("**%s**\n%s", title, markdown))
-	markdownRunes := []rune(markdown)
-	if len(markdownRunes) > max {
-		return fmt.Sprintf("%s ...", string(markdownRunes[:max]))
+	return ProcessMarkdownContent(title, markdown, max)
+}
+
+// ProcessMarkdownContent is like ProcessFeedContent for content that already
+// is Markdown and needs no conversion.
+func ProcessMarkdownContent(title, markdown string, max int) string {
+	if title != "" {
+		markdown = fmt.Sprintf("**%s**\n%s", title, markdown)
 	}
-	return markdown
+	return TruncateMarkdown(CleanTwt(markdown), max)
 }
 
 func TestRSSFeed(uri string) (*gofeed.Feed, error) {
@@ -164,16 +272,47 @@ func ValidateRSSFeed(conf *Config, uri string) (Feed, error) {
 		Avatar:      avatar,
 		Description: feed.Description,
 		Type:        FeedTypeRSS,
+		Link:        feed.Link,
+		Lang:        normalizeLang(feed.Language),
+		Refresh:     RefreshInterval(itemTimes(feed.Items)),
 	}, nil
 }
 
 func UpdateRSSFeed(conf *Config, name, url string) error {
+	res, err := HTTPGet(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxFeedDocumentSize))
+	if err != nil {
+		return fmt.Errorf("error reading feed %s: %w", url, err)
+	}
+
 	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(url)
+	feed, err := fp.Parse(bytes.NewReader(data))
 	if err != nil {
 		return err
 	}
 
+	if conf.WebSub {
+		if hub, topic := DiscoverWebSubHub(res.Header, data); hub != "" {
+			if topic == "" {
+				topic = url
+			}
+			if err := EnsureWebSubSubscription(conf, name, hub, topic); err != nil {
+				log.WithError(err).Warnf("error subscribing to %s via websub hub %s", topic, hub)
+			}
+		}
+	}
+
+	return ProcessRSSFeed(conf, name, url, feed)
+}
+
+// ProcessRSSFeed processes a fetched (or pushed) RSS/Atom `feed` of the
+// upstream `url` into the feed `name`.
+func ProcessRSSFeed(conf *Config, name, url string, feed *gofeed.Feed) error {
 	avatarFile := filepath.Join(conf.DataDir, fmt.Sprintf("%s.png", name))
 	if feed.Image != nil && feed.Image.URL != "" && !Exists(avatarFile) {
 		opts := &ImageOptions{
@@ -189,48 +328,192 @@ func UpdateRSSFeed(conf *Config, name, url string) error {
 		}
 	}
 
+	lang := SetItemsLanguage(feed.Items, feed.Language)
+	updateFeedMeta(conf, name, feed.Link, lang, RefreshInterval(itemTimes(feed.Items)))
+
+	return AppendFeedItems(conf, name, url, feed.Items)
+}
+
+// AppendFeedItems appends the `items` of the upstream feed `url` published
+// since the feed `name` was last modified as twts.
+func AppendFeedItems(conf *Config, name, url string, items []*gofeed.Item) error {
 	var lastModified = time.Time{}
 
 	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name))
 
 	stat, err := os.Stat(fn)
-	if err == nil {
+	exists := err == nil
+	if exists {
 		lastModified = stat.ModTime()
 	}
 
-	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	// When backfilling items older than the feed are written too, unless
+	// they were written before to the feed or its archives.
+	written := make(map[string]bool)
+	if conf.backfilling(name) {
+		lastModified = time.Time{}
+		if written, err = writtenItems(conf, name); err != nil {
+			return err
+		}
+	}
+
+	ts, err := LoadTimestamps(conf, name)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	ts.Prune(lastModified)
 
-	old, new := 0, 0
-	for _, item := range feed.Items {
+	var newItems []*gofeed.Item
+
+	old := 0
+	for _, item := range items {
 		if item.PublishedParsed == nil {
 			continue
 		}
 
-		if item.PublishedParsed.After(lastModified) {
-			new++
-			text := fmt.Sprintf(
-				twtxtTemplate,
-				item.PublishedParsed.Format(time.RFC3339),
-				ProcessFeedContent(item.Title, item.Description, maxTwtLength-len(item.Link)),
-				item.Link,
-			)
-			_, err := f.WriteString(text)
-			if err != nil {
-				return err
-			}
+		if item.PublishedParsed.After(lastModified) && !written[itemKey(item)] && !written[item.Link] && !ts.Written(itemKey(item)) {
+			newItems = append(newItems, item)
 		} else {
 			old++
 		}
 	}
 
-	if (old + new) == 0 {
+	if (old + len(newItems)) == 0 {
 		log.WithField("name", name).WithField("url", url).Warn("empty or bad feed")
 	}
 
+	limited := newestItems(newItems, conf.ItemLimit(name, exists))
+	if skipped := len(newItems) - len(limited); skipped > 0 {
+		log.WithField("name", name).Infof("skipping %d older items over the limit of %d", skipped, len(limited))
+	}
+
+	if err := writeFeedItems(conf, name, limited, ts); err != nil {
+		return err
+	}
+
+	if feed := conf.Feeds[name]; feed != nil && feed.Edits {
+		return WriteItemEdits(conf, name, items)
+	}
+
+	return nil
+}
+
+// WriteFeedItems writes the `items` to the feed `name` as twts in
+// chronological order, regardless of whether they are new, for sources that
+// keep track of new items themselves. Like AppendFeedItems only the newest
+// items up to the feed's limit are written.
+func WriteFeedItems(conf *Config, name string, items []*gofeed.Item) error {
+	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name))
+
+	items = sortItems(items)
+	limited := newestItems(items, conf.ItemLimit(name, Exists(fn)))
+	if skipped := len(items) - len(limited); skipped > 0 {
+		log.WithField("name", name).Infof("skipping %d older items over the limit of %d", skipped, len(limited))
+	}
+
+	ts, err := LoadTimestamps(conf, name)
+	if err != nil {
+		return err
+	}
+	return writeFeedItems(conf, name, limited, ts)
+}
+
+func writeFeedItems(conf *Config, name string, items []*gofeed.Item, ts *Timestamps) error {
+	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name))
+
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	feed := conf.Feeds[name]
+
+	filters := feedFilters(conf, name)
+
+	written := make(map[string]*itemState)
+	keys := make(map[string]string)
+	langs := make(map[string]string)
+	mentions := NewMentions(conf)
+
+	new := 0
+	for _, item := range sortItems(items) {
+		if allowed, rule := filters.Allow(item); !allowed {
+			log.WithField("name", name).Debugf("skipping %q (%v)", item.Title, rule)
+			continue
+		}
+
+		ResolveItemArticle(conf, name, item)
+
+		lang := ItemLanguage(item)
+		if !feed.AllowLanguage(lang) {
+			log.WithField("name", name).Debugf("skipping %q (language %s)", item.Title, lang)
+			continue
+		}
+
+		ResolveItemMedia(conf, name, item)
+
+		text, thread, err := formatItemThread(conf, mentions, name, item)
+		if err != nil {
+			return err
+		}
+		if text == "" {
+			log.WithField("name", name).Debugf("skipping %q (empty twt)", item.Title)
+			continue
+		}
+		new++
+
+		times := ts.NextThread(itemKey(item), *item.PublishedParsed, len(thread))
+		created := times[0]
+		line := fmt.Sprintf(twtxtTemplate, created.Format(time.RFC3339), text)
+		if _, err := f.WriteString(line); err != nil {
+			return err
+		}
+
+		hash := TwtHash(URLForFeed(conf, name), created, text)
+		keys[itemKey(item)] = hash
+		if lang != "" {
+			langs[hash] = lang
+		}
+
+		for i, part := range thread {
+			created := times[i+1]
+			part = ThreadTwt(hash, part)
+
+			line := fmt.Sprintf(twtxtTemplate, created.Format(time.RFC3339), part)
+			if _, err := f.WriteString(line); err != nil {
+				return err
+			}
+
+			if lang != "" {
+				langs[TwtHash(URLForFeed(conf, name), created, part)] = lang
+			}
+		}
+		if feed != nil && feed.Edits {
+			written[itemKey(item)] = newItemState(hash, item)
+		}
+	}
+
+	if err := ts.Save(); err != nil {
+		return err
+	}
+
+	if err := recordLanguages(conf, name, langs); err != nil {
+		return err
+	}
+
+	if err := recordItems(conf, name, written); err != nil {
+		return err
+	}
+
+	if err := recordItemKeys(conf, name, keys); err != nil {
+		return err
+	}
+
+	if new > 0 {
+		conf.NotifyFeedUpdated(name)
+	}
+
 	return nil
 }
 
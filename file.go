@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-yaml/yaml"
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// fileState is the state kept between updates of a `file://` source, the
+// offset up to which a tailed file has been read (once it is tailed) or the
+// Markdown files of a watched directory that have been published.
+type fileState struct {
+	Tailed bool     `json:"tailed,omitempty"`
+	Offset int64    `json:"offset,omitempty"`
+	Seen   []string `json:"seen,omitempty"`
+}
+
+// FrontMatter is the front matter of a Markdown file.
+type FrontMatter struct {
+	Title       string   `yaml:"title"`
+	Date        string   `yaml:"date"`
+	Link        string   `yaml:"link"`
+	URL         string   `yaml:"url"`
+	Summary     string   `yaml:"summary"`
+	Description string   `yaml:"description"`
+	Author      string   `yaml:"author"`
+	Tags        []string `yaml:"tags"`
+	Categories  []string `yaml:"categories"`
+	Draft       bool     `yaml:"draft"`
+}
+
+// FileSourcePath returns the local path of a `file://` source.
+func FileSourcePath(uri string) (string, error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Type != "file" {
+		return "", fmt.Errorf("error: not a file uri %q", uri)
+	}
+	if !filepath.IsAbs(u.Rest) {
+		return "", fmt.Errorf("error: file path %q must be absolute", u.Rest)
+	}
+
+	return filepath.Clean(u.Rest), nil
+}
+
+// ParseFrontMatter splits a Markdown document into its front matter, if any,
+// and its body.
+func ParseFrontMatter(data []byte) (FrontMatter, string, error) {
+	var fm FrontMatter
+
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(text, "---\n") {
+		return fm, text, nil
+	}
+
+	end := strings.Index(text[4:], "\n---")
+	if end == -1 {
+		return fm, text, nil
+	}
+
+	if err := yaml.Unmarshal([]byte(text[4:4+end]), &fm); err != nil {
+		return fm, "", fmt.Errorf("error parsing front matter: %w", err)
+	}
+
+	body := text[4+end+len("\n---"):]
+	if i := strings.Index(body, "\n"); i != -1 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+
+	return fm, body, nil
+}
+
+// ParseDate parses a front matter date, either a plain date or a timestamp.
+func ParseDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return ParseTimestamp(s)
+}
+
+// MarkdownFileItem converts the Markdown file `fn` into a feed item, using
+// the file's modification time when its front matter has no date.
+func MarkdownFileItem(fn string) (*gofeed.Item, error) {
+	stat, err := os.Stat(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	fm, body, err := ParseFrontMatter(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fn, err)
+	}
+	if fm.Draft {
+		return nil, nil
+	}
+
+	published := stat.ModTime()
+	if fm.Date != "" {
+		if published, err = ParseDate(fm.Date); err != nil {
+			return nil, fmt.Errorf("error parsing date of %s: %w", fn, err)
+		}
+	}
+
+	title := fm.Title
+	if title == "" {
+		title = BaseWithoutExt(fn)
+	}
+
+	content := strings.TrimSpace(body)
+	if fm.Summary != "" {
+		content = fm.Summary
+	} else if fm.Description != "" {
+		content = fm.Description
+	}
+
+	link := fm.Link
+	if link == "" {
+		link = fm.URL
+	}
+
+	item := &gofeed.Item{
+		GUID:            filepath.Base(fn),
+		Title:           title,
+		Description:     content,
+		Link:            link,
+		PublishedParsed: &published,
+		Categories:      append(append([]string{}, fm.Categories...), fm.Tags...),
+		Custom:          map[string]string{ItemFormat: ItemFormatMarkdown},
+	}
+	if fm.Author != "" {
+		item.Author = &gofeed.Person{Name: fm.Author}
+	}
+
+	return item, nil
+}
+
+// UpdateFileFeed updates the feed `name` from the local `file://` source
+// `uri`, either a directory of Markdown files each published as a twt once,
+// or a file that is tailed with each new line published as a twt.
+func UpdateFileFeed(conf *Config, name, uri string) error {
+	path, err := FileSourcePath(uri)
+	if err != nil {
+		return err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	var state fileState
+	if err := LoadState(conf, name, "file", &state); err != nil {
+		return err
+	}
+
+	if stat.IsDir() {
+		err = updateMarkdownDir(conf, name, path, &state)
+	} else {
+		err = tailFile(conf, name, path, stat, &state)
+	}
+	if err != nil {
+		return err
+	}
+
+	return SaveState(conf, name, "file", state)
+}
+
+func updateMarkdownDir(conf *Config, name, dir string, state *fileState) error {
+	files, err := WalkMatch(dir, "*.md")
+	if err != nil {
+		return fmt.Errorf("error reading directory %s: %w", dir, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, fn := range state.Seen {
+		seen[fn] = true
+	}
+
+	var items []*gofeed.Item
+	for _, fn := range files {
+		rel, err := filepath.Rel(dir, fn)
+		if err != nil || seen[rel] {
+			continue
+		}
+
+		item, err := MarkdownFileItem(fn)
+		if err != nil {
+			log.WithError(err).Warnf("error reading markdown file %s", fn)
+			continue
+		}
+		if item == nil {
+			// Drafts are picked up once they are published.
+			continue
+		}
+
+		seen[rel] = true
+		state.Seen = append(state.Seen, rel)
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].PublishedParsed.Before(*items[j].PublishedParsed)
+	})
+
+	return WriteFeedItems(conf, name, items)
+}
+
+func tailFile(conf *Config, name, path string, stat os.FileInfo, state *fileState) error {
+	// A file is tailed from its end, what it already holds is not published.
+	if !state.Tailed {
+		state.Tailed, state.Offset = true, stat.Size()
+		return nil
+	}
+
+	// The file was truncated or replaced (rotated) so start over.
+	if stat.Size() < state.Offset {
+		state.Offset = 0
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(state.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	// Only consume complete lines, a partially written line is picked up on
+	// the next update.
+	end := bytes.LastIndexByte(data, '\n')
+	if end == -1 {
+		return nil
+	}
+	data = data[:end+1]
+
+	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name))
+	exists := Exists(fn)
+
+	ts, err := LoadTimestamps(conf, name)
+	if err != nil {
+		return err
+	}
+	ts.Prune(time.Now())
+
+	filters := feedFilters(conf, name)
+
+	var twts []Twt
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var created time.Time
+		if parts := strings.SplitN(line, "\t", 2); len(parts) == 2 {
+			if t, err := ParseTimestamp(parts[0]); err == nil {
+				created, line = t, strings.TrimSpace(parts[1])
+			}
+		}
+
+		twt := Twt{Created: created, Text: line}
+		if !created.IsZero() && ts.Written(twtKey(twt)) {
+			continue
+		}
+		if allowed, rule := filters.AllowTwt(twt); !allowed {
+			log.WithField("name", name).Debugf("skipping %q (%v)", line, rule)
+			continue
+		}
+		twts = append(twts, twt)
+	}
+
+	limited := newestTwts(twts, conf.ItemLimit(name, exists))
+	if skipped := len(twts) - len(limited); skipped > 0 {
+		log.WithField("name", name).Infof("skipping %d older lines over the limit of %d", skipped, len(limited))
+	}
+
+	of, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer of.Close()
+
+	// Lines without a timestamp are given consecutive ones up to now.
+	var stamps []time.Time
+	for _, twt := range limited {
+		if twt.Created.IsZero() {
+			stamps = append(stamps, twt.Created)
+		}
+	}
+	if len(stamps) > 0 {
+		stamps = ts.NextThread("", time.Now(), len(stamps)-1)
+	}
+
+	new := 0
+	for _, twt := range limited {
+		created := twt.Created
+		if created.IsZero() {
+			created, stamps = stamps[0], stamps[1:]
+		} else {
+			created = ts.Next(twtKey(twt), created)
+		}
+
+		if err := AppendTwt(of, CleanTwt(twt.Text), created); err != nil {
+			log.WithError(err).Warnf("error appending line from %s", path)
+			continue
+		}
+		new++
+	}
+
+	if err := ts.Save(); err != nil {
+		return err
+	}
+
+	state.Offset += int64(end + 1)
+
+	if new > 0 {
+		conf.NotifyFeedUpdated(name)
+	}
+
+	return nil
+}
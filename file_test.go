@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fm, body, err := ParseFrontMatter([]byte("---\ntitle: Release 1.0\ndate: 2021-01-02\ntags: [release, go]\n---\nWe shipped **1.0**!\n"))
+	require.NoError(err)
+	assert.Equal("Release 1.0", fm.Title)
+	assert.Equal("2021-01-02", fm.Date)
+	assert.Equal([]string{"release", "go"}, fm.Tags)
+	assert.Equal("We shipped **1.0**!\n", body)
+
+	fm, body, err = ParseFrontMatter([]byte("No front matter here"))
+	require.NoError(err)
+	assert.Equal("", fm.Title)
+	assert.Equal("No front matter here", body)
+}
+
+func TestUpdateFileFeed(t *testing.T) {
+	t.Run("markdown directory", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dir := t.TempDir()
+		write := func(fn, content string) {
+			require.NoError(os.WriteFile(filepath.Join(dir, fn), []byte(content), 0644))
+		}
+		write("v1.md", "---\ntitle: Release 1.0\ndate: 2021-01-02\n---\nWe shipped **1.0**!\n")
+		write("draft.md", "---\ntitle: Release 2.0\ndraft: true\n---\nSoon\n")
+		write("notes.txt", "not markdown")
+
+		conf := NewConfig()
+		conf.DataDir = t.TempDir()
+		uri := "file://" + dir
+
+		require.NoError(UpdateFileFeed(conf, "changelog", uri))
+		twts, err := ReadTwts(filepath.Join(conf.DataDir, "changelog.txt"))
+		require.NoError(err)
+		require.Len(twts, 1)
+		assert.Equal("**Release 1.0**\u2028We shipped **1.0**!", twts[0].Text)
+		assert.Equal("2021-01-02", twts[0].Created.Format("2006-01-02"))
+
+		write("v0.md", "---\ntitle: Release 0.9\ndate: 2020-12-01\nlink: https://example.com/0.9\n---\nBeta\n")
+		require.NoError(UpdateFileFeed(conf, "changelog", uri))
+		twts, err = ReadTwts(filepath.Join(conf.DataDir, "changelog.txt"))
+		require.NoError(err)
+		require.Len(twts, 2)
+		assert.Contains(twts[1].Text, "[Read more](https://example.com/0.9)")
+	})
+
+	t.Run("tailed file", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		fn := filepath.Join(t.TempDir(), "deploys.log")
+		require.NoError(os.WriteFile(fn, []byte("deployed v0\n"), 0644))
+
+		conf := NewConfig()
+		conf.DataDir = t.TempDir()
+		uri := "file://" + fn
+
+		appendLog := func(s string) {
+			f, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0644)
+			require.NoError(err)
+			_, err = f.WriteString(s)
+			require.NoError(err)
+			require.NoError(f.Close())
+		}
+
+		// What the file holds when it is first tailed is not published.
+		require.NoError(UpdateFileFeed(conf, "deploys", uri))
+		twts, err := ReadTwts(filepath.Join(conf.DataDir, "deploys.txt"))
+		require.NoError(err)
+		require.Len(twts, 0)
+
+		appendLog("deployed v1\n2021-01-01T00:00:00Z\tdeployed v2\npartial")
+		require.NoError(UpdateFileFeed(conf, "deploys", uri))
+		twts, err = ReadTwts(filepath.Join(conf.DataDir, "deploys.txt"))
+		require.NoError(err)
+		require.Len(twts, 2)
+		assert.Equal("deployed v1", twts[0].Text)
+		assert.Equal("deployed v2", twts[1].Text)
+		assert.Equal(2021, twts[1].Created.Year())
+
+		appendLog(" line done\n")
+
+		require.NoError(UpdateFileFeed(conf, "deploys", uri))
+		twts, err = ReadTwts(filepath.Join(conf.DataDir, "deploys.txt"))
+		require.NoError(err)
+		require.Len(twts, 3)
+		assert.Equal("partial line done", twts[2].Text)
+
+		// A truncated file is read again from the start.
+		require.NoError(os.WriteFile(fn, []byte("fresh\n"), 0644))
+		require.NoError(UpdateFileFeed(conf, "deploys", uri))
+		twts, err = ReadTwts(filepath.Join(conf.DataDir, "deploys.txt"))
+		require.NoError(err)
+		require.Len(twts, 4)
+		assert.Equal("fresh", twts[3].Text)
+
+		// Lines are stamped in order with distinct timestamps, and future
+		// ones are clamped and not written again.
+		future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		appendLog("one\ntwo\n" + future + "\tlater\n")
+		require.NoError(UpdateFileFeed(conf, "deploys", uri))
+		require.NoError(os.WriteFile(fn, []byte(future+"\tlater\n"), 0644))
+		require.NoError(UpdateFileFeed(conf, "deploys", uri))
+		twts, err = ReadTwts(filepath.Join(conf.DataDir, "deploys.txt"))
+		require.NoError(err)
+		require.Len(twts, 7)
+		assert.Equal("one", twts[4].Text)
+		assert.True(twts[4].Created.Before(twts[5].Created))
+		assert.Equal("later", twts[6].Text)
+		assert.False(twts[6].Created.After(time.Now()))
+	})
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Fields of an item a FilterRule can match on.
+const (
+	FilterFieldAny        = "any"
+	FilterFieldTitle      = "title"
+	FilterFieldBody       = "body"
+	FilterFieldCategories = "categories"
+	FilterFieldAuthor     = "author"
+	FilterFieldLink       = "link"
+)
+
+// FilterRule matches items whose `Field` (or any field) matches a regular
+// expression or contains a keyword (case-insensitive).
+type FilterRule struct {
+	Field   string `yaml:"field,omitempty"`
+	Regex   string `yaml:"regex,omitempty"`
+	Keyword string `yaml:"keyword,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// FeedFilters are the include/exclude rules of a feed. An item is written if
+// it matches any include rule (or there are none) and no exclude rule.
+type FeedFilters struct {
+	Include []*FilterRule `yaml:"include,omitempty"`
+	Exclude []*FilterRule `yaml:"exclude,omitempty"`
+}
+
+// Compile validates and compiles the rules.
+func (filters *FeedFilters) Compile() error {
+	if filters == nil {
+		return nil
+	}
+
+	for _, rule := range append(append([]*FilterRule{}, filters.Include...), filters.Exclude...) {
+		if err := rule.compile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rule *FilterRule) compile() error {
+	switch rule.Field {
+	case "", FilterFieldAny, FilterFieldTitle, FilterFieldBody, FilterFieldCategories, FilterFieldAuthor, FilterFieldLink:
+	default:
+		return fmt.Errorf("error: invalid filter field %q", rule.Field)
+	}
+
+	if (rule.Regex == "") == (rule.Keyword == "") {
+		return fmt.Errorf("error: filter rule must have exactly one of regex or keyword")
+	}
+
+	if rule.Regex != "" {
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return fmt.Errorf("error: invalid filter regex %q: %w", rule.Regex, err)
+		}
+		rule.re = re
+	}
+
+	return nil
+}
+
+// String returns a human readable description of the rule.
+func (rule *FilterRule) String() string {
+	field := rule.Field
+	if field == "" {
+		field = FilterFieldAny
+	}
+	if rule.Regex != "" {
+		return fmt.Sprintf("%s =~ /%s/", field, rule.Regex)
+	}
+	return fmt.Sprintf("%s contains %q", field, rule.Keyword)
+}
+
+// Match returns true if the rule matches the `item`.
+func (rule *FilterRule) Match(item *gofeed.Item) bool {
+	if rule.re == nil && rule.Regex != "" {
+		if err := rule.compile(); err != nil {
+			return false
+		}
+	}
+
+	for _, value := range itemFieldValues(item, rule.Field) {
+		if rule.re != nil {
+			if rule.re.MatchString(value) {
+				return true
+			}
+		} else if strings.Contains(strings.ToLower(value), strings.ToLower(rule.Keyword)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func itemFieldValues(item *gofeed.Item, field string) []string {
+	switch field {
+	case FilterFieldTitle:
+		return []string{item.Title}
+	case FilterFieldBody:
+		return []string{item.Description, item.Content}
+	case FilterFieldCategories:
+		return item.Categories
+	case FilterFieldAuthor:
+		var values []string
+		if item.Author != nil {
+			values = append(values, item.Author.Name, item.Author.Email)
+		}
+		for _, author := range item.Authors {
+			if author != nil {
+				values = append(values, author.Name, author.Email)
+			}
+		}
+		return values
+	case FilterFieldLink:
+		return append([]string{item.Link}, item.Links...)
+	default:
+		var values []string
+		for _, field := range []string{FilterFieldTitle, FilterFieldBody, FilterFieldCategories, FilterFieldAuthor, FilterFieldLink} {
+			values = append(values, itemFieldValues(item, field)...)
+		}
+		return values
+	}
+}
+
+// Allow returns true if the `item` passes the filters, and otherwise the rule
+// that rejected it (nil if it matched no include rule).
+func (filters *FeedFilters) Allow(item *gofeed.Item) (bool, *FilterRule) {
+	if filters == nil {
+		return true, nil
+	}
+
+	for _, rule := range filters.Exclude {
+		if rule.Match(item) {
+			return false, rule
+		}
+	}
+
+	if len(filters.Include) == 0 {
+		return true, nil
+	}
+
+	for _, rule := range filters.Include {
+		if rule.Match(item) {
+			return true, rule
+		}
+	}
+
+	return false, nil
+}
+
+// AllowTwt is like Allow for a `twt` of a source of twts rather than items,
+// whose text is matched as the body of an item.
+func (filters *FeedFilters) AllowTwt(twt Twt) (bool, *FilterRule) {
+	return filters.Allow(&gofeed.Item{Description: twt.Text})
+}
+
+// feedFilters returns the filters of the feed `name`, if any.
+func feedFilters(conf *Config, name string) *FeedFilters {
+	if feed := conf.Feeds[name]; feed != nil {
+		return feed.Filters
+	}
+	return nil
+}
+
+// FetchFeedItems fetches the current items of the upstream source `uri`
+// without writing anything, for sources that can be fetched idempotently.
+func FetchFeedItems(uri string) ([]*gofeed.Item, error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Type {
+	case "rss", "http", "https":
+		res, err := HTTPGet(uri)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		feed, err := gofeed.NewParser().Parse(io.LimitReader(res.Body, maxFeedDocumentSize))
+		if err != nil {
+			return nil, err
+		}
+		return feed.Items, nil
+	case "gemini":
+		_, items, err := FetchGeminiFeed(uri)
+		return items, err
+	default:
+		return nil, fmt.Errorf("error: unsupported feed type %q for a dry-run", u.Type)
+	}
+}
+
+// DryRunFilters fetches the recent items of the feed `name` and writes to `w`
+// which would pass its filters and which would not (and why), without
+// writing any twts.
+func DryRunFilters(conf *Config, name string, w io.Writer) error {
+	feed, ok := conf.Feeds[name]
+	if !ok {
+		return fmt.Errorf("error: unknown feed %s", name)
+	}
+
+	if err := feed.Filters.Compile(); err != nil {
+		return err
+	}
+
+	items, err := FetchFeedItems(feed.URI)
+	if err != nil {
+		return err
+	}
+
+	SetItemsLanguage(items, "")
+
+	for _, item := range items {
+		allowed, rule := feed.Filters.Allow(item)
+		lang := ItemLanguage(item)
+
+		var reason string
+		switch {
+		case allowed && rule != nil:
+			reason = fmt.Sprintf("included by %s", rule)
+		case allowed:
+			reason = "no rules matched"
+		case rule != nil:
+			reason = fmt.Sprintf("excluded by %s", rule)
+		default:
+			reason = "matched no include rule"
+		}
+
+		if allowed && !feed.AllowLanguage(lang) {
+			allowed, reason = false, fmt.Sprintf("language %s not allowed", lang)
+		}
+
+		status := "SKIP"
+		if allowed {
+			status = "PASS"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, item.Title, reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0">
+  <channel>
+    <title>Example</title>
+    <link>https://example.com/</link>
+    <item>
+      <title>Go 1.20 released</title>
+      <link>https://example.com/go</link>
+      <category>golang</category>
+      <description>All about the new release</description>
+      <pubDate>Sat, 02 Jan 2021 10:00:00 +0000</pubDate>
+    </item>
+    <item>
+      <title>Sponsored: Buy our stuff</title>
+      <link>https://example.com/ad</link>
+      <category>golang</category>
+      <description>Ads</description>
+      <pubDate>Sat, 02 Jan 2021 11:00:00 +0000</pubDate>
+    </item>
+    <item>
+      <title>Rust news</title>
+      <link>https://example.com/rust</link>
+      <category>rust</category>
+      <description>Not Go</description>
+      <pubDate>Sat, 02 Jan 2021 12:00:00 +0000</pubDate>
+    </item>
+  </channel>
+</rss>`
+
+func TestFeedFilters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	filters := &FeedFilters{
+		Include: []*FilterRule{{Field: FilterFieldCategories, Regex: "^go(lang)?$"}},
+		Exclude: []*FilterRule{{Field: FilterFieldTitle, Keyword: "sponsored"}},
+	}
+	require.NoError(filters.Compile())
+
+	allowed, rule := filters.Allow(&gofeed.Item{Title: "Go 1.20", Categories: []string{"golang"}})
+	assert.True(allowed)
+	assert.Equal(filters.Include[0], rule)
+
+	allowed, rule = filters.Allow(&gofeed.Item{Title: "SPONSORED", Categories: []string{"golang"}})
+	assert.False(allowed)
+	assert.Equal(filters.Exclude[0], rule)
+
+	allowed, rule = filters.Allow(&gofeed.Item{Title: "Rust", Categories: []string{"rust"}})
+	assert.False(allowed)
+	assert.Nil(rule)
+
+	allowed, _ = (*FeedFilters)(nil).Allow(&gofeed.Item{})
+	assert.True(allowed)
+
+	assert.True((&FilterRule{Keyword: "alice"}).Match(&gofeed.Item{Author: &gofeed.Person{Name: "Alice"}}))
+	assert.True((&FilterRule{Field: FilterFieldLink, Regex: `/go$`}).Match(&gofeed.Item{Link: "https://example.com/go"}))
+
+	assert.Error((&FeedFilters{Include: []*FilterRule{{Regex: "("}}}).Compile())
+	assert.Error((&FeedFilters{Include: []*FilterRule{{Field: "nope", Keyword: "x"}}}).Compile())
+	assert.Error((&FeedFilters{Include: []*FilterRule{{}}}).Compile())
+}
+
+func TestDryRunFilters(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testRSS)
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+	conf.Feeds["example"] = &Feed{
+		Name: "example",
+		URI:  server.URL,
+		Filters: &FeedFilters{
+			Include: []*FilterRule{{Field: FilterFieldCategories, Keyword: "golang"}},
+			Exclude: []*FilterRule{{Field: FilterFieldTitle, Regex: "^Sponsored:"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(DryRunFilters(conf, "example", &buf))
+
+	assert.Equal(t, "PASS\tGo 1.20 released\tincluded by categories contains \"golang\"\n"+
+		"SKIP\tSponsored: Buy our stuff\texcluded by title =~ /^Sponsored:/\n"+
+		"SKIP\tRust news\tmatched no include rule\n", buf.String())
+}
+
+func TestFilteredTwts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	filters := &FeedFilters{Exclude: []*FilterRule{{Keyword: "spam"}}}
+	require.NoError(filters.Compile())
+	conf.Feeds["mirror"] = &Feed{Name: "mirror", Filters: filters}
+	conf.Feeds["deploys"] = &Feed{Name: "deploys", Filters: filters}
+
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(AppendNewTwts(conf, "mirror", []Twt{
+		{Created: created, Text: "Hello"},
+		{Created: created.Add(time.Second), Text: "Buy SPAM"},
+	}))
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "mirror.txt"))
+	require.NoError(err)
+	require.Len(twts, 1)
+	assert.Equal("Hello", twts[0].Text)
+
+	fn := filepath.Join(t.TempDir(), "deploys.log")
+	require.NoError(os.WriteFile(fn, nil, 0644))
+	require.NoError(UpdateFileFeed(conf, "deploys", "file://"+fn))
+	require.NoError(os.WriteFile(fn, []byte("deployed v1\nspam v2\n"), 0644))
+	require.NoError(UpdateFileFeed(conf, "deploys", "file://"+fn))
+	twts, err = ReadTwts(filepath.Join(conf.DataDir, "deploys.txt"))
+	require.NoError(err)
+	require.Len(twts, 1)
+	assert.Equal("deployed v1", twts[0].Text)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	readMoreTemplate = "%s ⌘ [Read more](%s)"
+
+	// maxHashtagsLength is the most of a twt's budget spent on hashtags
+	maxHashtagsLength = maxTwtLength / 4
+)
+
+// TwtContext is the data a feed's twt template is executed with.
+type TwtContext struct {
+	Feed string
+
+	Title   string
+	Summary string
+	Content string
+	Link    string
+	Author  string
+	Media   string
+
+	// AuthorMention is the mention of the author's feed if we aggregate it
+	AuthorMention string
+
+	// Hashtags are the allowed categories as twtxt hashtags
+	Hashtags string
+
+	Categories []string
+	Enclosures []*gofeed.Enclosure
+}
+
+var twtTemplateFuncs = template.FuncMap{
+	"join": func(sep string, values []string) string {
+		return strings.Join(values, sep)
+	},
+	"truncate": func(n int, s string) string {
+		runes := []rune(s)
+		if len(runes) > n {
+			return string(runes[:n]) + " ..."
+		}
+		return s
+	},
+}
+
+// CompileTemplate parses and validates the feed's twt template, if any, by
+// executing it against an empty item.
+func (feed *Feed) CompileTemplate() error {
+	feed.template = nil
+	if feed.Template == "" {
+		return nil
+	}
+
+	tmpl, err := template.New(feed.Name).Funcs(twtTemplateFuncs).Option("missingkey=error").Parse(feed.Template)
+	if err != nil {
+		return fmt.Errorf("error parsing twt template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, TwtContext{Feed: feed.Name}); err != nil {
+		return fmt.Errorf("error in twt template: %w", err)
+	}
+
+	feed.template = tmpl
+	return nil
+}
+
+// NewTwtContext returns the template data of the `item` of the feed `name`
+// with its summary and content converted to Markdown.
+func NewTwtContext(conf *Config, name string, item *gofeed.Item) TwtContext {
+	return newTwtContext(conf, NewMentions(conf), name, item)
+}
+
+func newTwtContext(conf *Config, mentions *Mentions, name string, item *gofeed.Item) TwtContext {
+	feed := conf.Feeds[name]
+
+	ctx := TwtContext{
+		Feed:          name,
+		Hashtags:      FormatHashtags(ItemHashtags(feed, item), maxHashtagsLength),
+		Title:         item.Title,
+		Link:          item.Link,
+		Media:         item.Custom[ItemMedia],
+		AuthorMention: mentions.Author(name, item),
+		Categories:    item.Categories,
+		Enclosures:    item.Enclosures,
+	}
+
+	if item.Author != nil {
+		ctx.Author = item.Author.Name
+	} else if len(item.Authors) > 0 && item.Authors[0] != nil {
+		ctx.Author = item.Authors[0].Name
+	}
+
+	ctx.Summary = mentions.Expand(name, itemMarkdown(feed, item, item.Description))
+	ctx.Content = mentions.Expand(name, itemMarkdown(feed, item, item.Content))
+
+	return ctx
+}
+
+// itemMarkdown returns the `content` of the `item` as Markdown converted
+// with the feed's conversion rules.
+func itemMarkdown(feed *Feed, item *gofeed.Item, content string) string {
+	if item.Custom[ItemFormat] == ItemFormatMarkdown {
+		return content
+	}
+
+	markdown, err := feed.Converter().Convert(content, item.Link)
+	if err != nil {
+		log.WithError(err).Warnf("error converting content to html")
+		return content
+	}
+	return markdown
+}
+
+// FormatItem renders the `item` of the feed `name` as the text of a twt,
+// with the feed's own template if it has one and otherwise as its title and
+// content followed by a link to read more. Sources we also aggregate are
+// mentioned.
+func FormatItem(conf *Config, name string, item *gofeed.Item) (string, error) {
+	return formatItem(conf, NewMentions(conf), name, item, maxTwtLength)
+}
+
+func formatItem(conf *Config, mentions *Mentions, name string, item *gofeed.Item, length int) (string, error) {
+	feed := conf.Feeds[name]
+
+	if feed != nil && feed.Template != "" {
+		if feed.template == nil {
+			if err := feed.CompileTemplate(); err != nil {
+				return "", err
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := feed.template.Execute(&buf, newTwtContext(conf, mentions, name, item)); err != nil {
+			return "", fmt.Errorf("error executing twt template: %w", err)
+		}
+		return ProcessMarkdownContent("", buf.String(), length), nil
+	}
+
+	markdown := mentions.Expand(name, itemMarkdown(feed, item, item.Description))
+
+	// Plain text has no bold titles, the title is a line of its own.
+	title := item.Title
+	if feed.Converter().PlainText() && title != "" {
+		markdown = title + "\n" + markdown
+		title = ""
+	}
+
+	// The link, media and tail are kept as long as they fit, what is left of
+	// the budget is the content's.
+	max := length - len(item.Link)
+	media := item.Custom[ItemMedia]
+	if media != "" {
+		if len(media)+1 > max {
+			media = ""
+		} else {
+			max -= len(media) + 1
+		}
+	}
+	tail := FormatHashtags(ItemHashtags(feed, item), maxHashtagsLength)
+	if author := mentions.Author(name, item); author != "" {
+		tail = strings.TrimSpace("by " + author + " " + tail)
+	}
+	if tail != "" {
+		if len(tail)+1 > max {
+			tail = ""
+		} else {
+			max -= len(tail) + 1
+		}
+	}
+	if max < 0 {
+		max = 0
+	}
+
+	text := withMedia(withHashtags(ProcessMarkdownContent(title, markdown, max), tail), media)
+	if item.Link == "" {
+		return text, nil
+	}
+
+	return fmt.Sprintf(readMoreTemplate, text, item.Link), nil
+}
+
+func withHashtags(text, hashtags string) string {
+	if hashtags == "" {
+		return text
+	}
+	if text == "" {
+		return hashtags
+	}
+	return text + " " + hashtags
+}
+
+func withMedia(text, media string) string {
+	if media == "" {
+		return text
+	}
+	if text == "" {
+		return media
+	}
+	return text + "\u2028" + media
+}
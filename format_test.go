@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatItem(t *testing.T) {
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	item := &gofeed.Item{
+		Title:           "Hello World",
+		Description:     "<p>A <em>short</em> summary</p>",
+		Content:         "<p>The full content</p>",
+		Link:            "https://example.com/hello",
+		Author:          &gofeed.Person{Name: "Jane"},
+		Categories:      []string{"go", "twtxt"},
+		Enclosures:      []*gofeed.Enclosure{{URL: "https://example.com/hello.mp3", Type: "audio/mpeg"}},
+		PublishedParsed: &published,
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"default", "", "**Hello World**\u2028A _short_ summary #go #twtxt ⌘ [Read more](https://example.com/hello)"},
+		{"link only", "{{ .Link }}", "https://example.com/hello"},
+		{"title only", "{{ .Title }}", "Hello World"},
+		{"everything", "{{ .Feed }}: {{ .Title }} by {{ .Author }} [{{ join \", \" .Categories }}]\n{{ .Content }}{{ range .Enclosures }} {{ .URL }}{{ end }}",
+			"example: Hello World by Jane [go, twtxt]\u2028The full content https://example.com/hello.mp3"},
+		{"truncate", "{{ truncate 5 .Title }}", "Hello ..."},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			feed := &Feed{Name: "example", Template: testCase.template, Hashtags: &FeedHashtags{Enabled: true}}
+			require.NoError(t, feed.CompileTemplate())
+
+			conf := NewConfig()
+			conf.Feeds["example"] = feed
+
+			text, err := FormatItem(conf, "example", item)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, text)
+		})
+	}
+}
+
+func TestFormatItemLongLinkAndMedia(t *testing.T) {
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	link := "https://example.com/" + strings.Repeat("a", 250)
+	media := "https://cdn.example.com/image.jpg?signature=" + strings.Repeat("b", 330)
+	item := &gofeed.Item{
+		Title:           "Hello World",
+		Description:     "<p>A <em>short</em> summary</p>",
+		Link:            link,
+		PublishedParsed: &published,
+		Custom:          map[string]string{ItemMedia: media},
+	}
+
+	conf := NewConfig()
+	conf.Feeds["example"] = &Feed{Name: "example"}
+
+	text, err := FormatItem(conf, "example", item)
+	require.NoError(t, err)
+	assert.NotContains(t, text, media)
+	assert.True(t, strings.HasSuffix(text, "[Read more]("+link+")"))
+
+	item.Link = "https://example.com/" + strings.Repeat("a", 600)
+	text, err = FormatItem(conf, "example", item)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(text, "[Read more]("+item.Link+")"))
+}
+
+func TestCompileTemplate(t *testing.T) {
+	assert.Error(t, (&Feed{Template: "{{ .Title "}).CompileTemplate())
+	assert.Error(t, (&Feed{Template: "{{ .Nope }}"}).CompileTemplate())
+	assert.Error(t, (&Feed{Template: "{{ shout .Title }}"}).CompileTemplate())
+	assert.NoError(t, (&Feed{}).CompileTemplate())
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	geminiDefaultPort  = "1965"
+	geminiMaxRedirects = 5
+	geminiTimeout      = 30 * time.Second
+	geminiMaxBodySize  = 1 << 22 // 4MB
+)
+
+var (
+	ErrGeminiTooManyRedirects = errors.New("error: too many gemini redirects")
+
+	// gemlogLinkRe matches gemtext link lines whose label starts with an
+	// ISO 8601 date, as per the Gemini subscription convention.
+	gemlogLinkRe = regexp.MustCompile(`^=>\s*(\S+)\s+(\d{4}-\d{2}-\d{2})(?:\s*[-–—:]?\s*(.*))?$`)
+)
+
+// geminiState is the state kept between updates of a Gemini feed, the links
+// of the entries since the day of its last update that were considered.
+type geminiState struct {
+	Seen []string `json:"seen"`
+}
+
+// GeminiResponse is the response to a Gemini request, its media type and body.
+type GeminiResponse struct {
+	URL      *url.URL
+	MimeType string
+	Body     []byte
+}
+
+// GeminiGet fetches `uri` over the Gemini protocol following redirects.
+//
+// NOTE: Gemini capsules overwhelmingly use self-signed certificates and
+// Trust-On-First-Use, so certificates are not verified against any CA.
+func GeminiGet(uri string) (*GeminiResponse, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i <= geminiMaxRedirects; i++ {
+		if u.Scheme != "gemini" {
+			return nil, fmt.Errorf("error: unsupported gemini url %q", u)
+		}
+
+		status, meta, body, err := geminiRequest(u)
+		if err != nil {
+			return nil, err
+		}
+
+		switch status / 10 {
+		case 2:
+			mimeType, _, err := mime.ParseMediaType(meta)
+			if err != nil || meta == "" {
+				mimeType = "text/gemini"
+			}
+			return &GeminiResponse{URL: u, MimeType: mimeType, Body: body}, nil
+		case 3:
+			next, err := u.Parse(meta)
+			if err != nil {
+				return nil, fmt.Errorf("error: invalid gemini redirect %q: %w", meta, err)
+			}
+			u = next
+		default:
+			return nil, fmt.Errorf("error: gemini request for %s failed with %d %s", u, status, meta)
+		}
+	}
+
+	return nil, ErrGeminiTooManyRedirects
+}
+
+func geminiRequest(u *url.URL) (int, string, []byte, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), geminiDefaultPort)
+	}
+
+	dialer := &net.Dialer{Timeout: geminiTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	})
+	if err != nil {
+		return 0, "", nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(geminiTimeout)); err != nil {
+		return 0, "", nil, err
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\r\n", u.String()); err != nil {
+		return 0, "", nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("error reading gemini response header: %w", err)
+	}
+	header = strings.TrimRight(header, "\r\n")
+
+	var (
+		status int
+		meta   string
+	)
+	if len(header) < 2 {
+		return 0, "", nil, fmt.Errorf("error: invalid gemini response header %q", header)
+	}
+	if _, err := fmt.Sscanf(header[:2], "%d", &status); err != nil {
+		return 0, "", nil, fmt.Errorf("error: invalid gemini response status %q", header)
+	}
+	meta = strings.TrimSpace(header[2:])
+
+	if status/10 != 2 {
+		return status, meta, nil, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r, geminiMaxBodySize))
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("error reading gemini response body: %w", err)
+	}
+
+	return status, meta, body, nil
+}
+
+// Gemlog is a gemlog index, its title and entries converted to feed items.
+type Gemlog struct {
+	Title string
+	Items []*gofeed.Item
+}
+
+// ParseGemlog parses a gemtext gemlog index at `base` into feed items, one for
+// each link line whose label is prefixed with a `YYYY-MM-DD` date.
+func ParseGemlog(base *url.URL, body []byte) *Gemlog {
+	gemlog := &Gemlog{}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if gemlog.Title == "" && strings.HasPrefix(line, "# ") {
+			gemlog.Title = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+			continue
+		}
+
+		match := gemlogLinkRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		link, err := base.Parse(match[1])
+		if err != nil {
+			continue
+		}
+
+		published, err := time.Parse("2006-01-02", match[2])
+		if err != nil {
+			continue
+		}
+
+		title := strings.TrimSpace(match[3])
+		if title == "" {
+			title = link.String()
+		}
+
+		gemlog.Items = append(gemlog.Items, &gofeed.Item{
+			Title:           title,
+			Link:            link.String(),
+			Published:       match[2],
+			PublishedParsed: &published,
+		})
+	}
+
+	return gemlog
+}
+
+// FetchGeminiFeed fetches a gemlog index or an Atom/RSS feed served over
+// Gemini and returns its title and items.
+func FetchGeminiFeed(uri string) (string, []*gofeed.Item, error) {
+	res, err := GeminiGet(uri)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch res.MimeType {
+	case "text/gemini":
+		gemlog := ParseGemlog(res.URL, res.Body)
+		title := gemlog.Title
+		if title == "" {
+			title = res.URL.Hostname()
+		}
+		return title, gemlog.Items, nil
+	case "application/atom+xml", "application/rss+xml", "application/xml", "text/xml":
+		feed, err := gofeed.NewParser().ParseString(string(res.Body))
+		if err != nil {
+			return "", nil, err
+		}
+		return feed.Title, feed.Items, nil
+	default:
+		return "", nil, fmt.Errorf("error: unsupported gemini feed type %q", res.MimeType)
+	}
+}
+
+// ValidateGeminiFeed validates a gemlog or Atom feed over Gemini given a `uri`
+// and returns a `Feed` object on success or a zero-value `Feed` object and
+// `error` on an error.
+func ValidateGeminiFeed(conf *Config, uri string) (Feed, error) {
+	title, items, err := FetchGeminiFeed(uri)
+	if err != nil {
+		return Feed{}, fmt.Errorf("error fetching gemini feed %q: %w", uri, err)
+	}
+
+	if len(items) == 0 {
+		return Feed{}, ErrNoSuitableFeedsFound
+	}
+
+	name := slug.Make(title)
+	if name == "" {
+		return Feed{}, fmt.Errorf("error: unable to determine a name for %q", uri)
+	}
+
+	return Feed{
+		Name:        name,
+		URI:         uri,
+		Description: CleanDesc(title),
+		Type:        FeedTypeGemini,
+		Link:        uri,
+		Refresh:     RefreshInterval(itemTimes(items)),
+	}, nil
+}
+
+// UpdateGeminiFeed appends new entries of the gemlog or Atom feed `uri` served
+// over Gemini to the feed `name`.
+func UpdateGeminiFeed(conf *Config, name, uri string) error {
+	_, items, err := FetchGeminiFeed(uri)
+	if err != nil {
+		return err
+	}
+
+	var state geminiState
+	if err := LoadState(conf, name, "gemini", &state); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, link := range state.Seen {
+		seen[link] = true
+	}
+
+	// Gemlog entries only carry a date, so entries discovered later on the
+	// same day as our last update would otherwise never be considered new.
+	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name))
+	if stat, err := os.Stat(fn); err == nil {
+		now := time.Now()
+		day := stat.ModTime().UTC().Truncate(24 * time.Hour)
+		for _, item := range items {
+			if item.PublishedParsed == nil || item.PublishedParsed.Before(day) || seen[item.Link] {
+				continue
+			}
+			if !item.PublishedParsed.After(stat.ModTime()) {
+				log.Debugf("stamping late gemlog entry %s with %s", item.Link, now)
+				item.PublishedParsed = &now
+			}
+		}
+	}
+
+	if err := AppendFeedItems(conf, name, uri, items); err != nil {
+		return err
+	}
+
+	// Only the entries since the day of this update are considered again.
+	stat, err := os.Stat(fn)
+	if err != nil {
+		return nil
+	}
+	day := stat.ModTime().UTC().Truncate(24 * time.Hour)
+
+	state.Seen = nil
+	for _, item := range items {
+		if item.PublishedParsed != nil && !item.PublishedParsed.Before(day) {
+			state.Seen = append(state.Seen, item.Link)
+		}
+	}
+
+	return SaveState(conf, name, "gemini", state)
+}
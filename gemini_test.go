@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGemlog = `# Alice's Gemlog
+
+Welcome to my capsule!
+
+=> /about.gmi About me
+=> /posts/second.gmi 2021-01-02 - Second post
+=> posts/first.gmi 2021-01-01 First post
+=> gemini://elsewhere.example/ 2020-12-31
+`
+
+const testGeminiAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Alice's Atom</title>
+  <id>gemini://localhost/atom.xml</id>
+  <updated>2021-01-02T00:00:00Z</updated>
+  <entry>
+    <title>Hello Gemini</title>
+    <link href="gemini://localhost/posts/hello.gmi"/>
+    <id>gemini://localhost/posts/hello.gmi</id>
+    <updated>2021-01-02T00:00:00Z</updated>
+    <published>2021-01-02T00:00:00Z</published>
+    <summary>Hello from Geminispace</summary>
+  </entry>
+</feed>
+`
+
+// newTestGeminiServer starts a Gemini server on a random local port with a
+// self-signed certificate, serving `responses` keyed by request path.
+func newTestGeminiServer(t *testing.T, responses map[string]string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				u, err := url.Parse(strings.TrimSpace(line))
+				if err != nil {
+					fmt.Fprint(conn, "59 bad request\r\n")
+					return
+				}
+				if res, ok := responses[u.Path]; ok {
+					fmt.Fprint(conn, res)
+					return
+				}
+				fmt.Fprint(conn, "51 not found\r\n")
+			}(conn)
+		}
+	}()
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+
+	return fmt.Sprintf("gemini://localhost:%s", port)
+}
+
+func TestGeminiFeeds(t *testing.T) {
+	today := time.Now().UTC().Format("2006-01-02")
+	base := newTestGeminiServer(t, map[string]string{
+		"/today/1":  "20 text/gemini\r\n=> /early.gmi " + today + " Early post\n",
+		"/today/2":  "20 text/gemini\r\n=> /late.gmi " + today + " Late post\n=> /early.gmi " + today + " Early post\n",
+		"/gemlog/":  "20 text/gemini; charset=utf-8\r\n" + testGemlog,
+		"/gemlog":   "31 /gemlog/\r\n",
+		"/atom.xml": "20 application/atom+xml\r\n" + testGeminiAtom,
+		"/loop":     "30 /loop\r\n",
+	})
+
+	t.Run("gemlog", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		title, items, err := FetchGeminiFeed(base + "/gemlog")
+		require.NoError(err)
+		assert.Equal("Alice's Gemlog", title)
+
+		require.Len(items, 3)
+		assert.Equal("Second post", items[0].Title)
+		assert.Equal(base+"/posts/second.gmi", items[0].Link)
+		assert.Equal("First post", items[1].Title)
+		assert.Equal(base+"/gemlog/posts/first.gmi", items[1].Link)
+		assert.Equal("gemini://elsewhere.example/", items[2].Title)
+		assert.Equal("2021-01-01", items[1].PublishedParsed.Format("2006-01-02"))
+	})
+
+	t.Run("atom", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		title, items, err := FetchGeminiFeed(base + "/atom.xml")
+		require.NoError(err)
+		assert.Equal("Alice's Atom", title)
+		require.Len(items, 1)
+		assert.Equal("Hello Gemini", items[0].Title)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, _, err := FetchGeminiFeed(base + "/missing")
+		assert.Error(t, err)
+
+		_, _, err = FetchGeminiFeed(base + "/loop")
+		assert.ErrorIs(t, err, ErrGeminiTooManyRedirects)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		conf := NewConfig()
+		conf.DataDir = t.TempDir()
+
+		feed, err := ValidateGeminiFeed(conf, base+"/gemlog/")
+		require.NoError(err)
+		assert.Equal("alices-gemlog", feed.Name)
+
+		require.NoError(UpdateGeminiFeed(conf, feed.Name, feed.URI))
+
+		data, err := os.ReadFile(filepath.Join(conf.DataDir, "alices-gemlog.txt"))
+		require.NoError(err)
+		assert.Contains(string(data), "2021-01-02T00:00:00Z\t**Second post**")
+		assert.Equal(3, strings.Count(string(data), "\n"))
+	})
+
+	t.Run("late", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		conf := NewConfig()
+		conf.DataDir = t.TempDir()
+		conf.Feeds["today"] = &Feed{Name: "today", Template: "{{ .Title }}"}
+
+		// Entries published later on the day of the last update are new.
+		require.NoError(UpdateGeminiFeed(conf, "today", base+"/today/1"))
+		require.NoError(UpdateGeminiFeed(conf, "today", base+"/today/2"))
+		require.NoError(UpdateGeminiFeed(conf, "today", base+"/today/2"))
+
+		twts, err := ReadTwts(filepath.Join(conf.DataDir, "today.txt"))
+		require.NoError(err)
+		require.Len(twts, 2)
+		assert.Equal("Early post", twts[0].Text)
+		assert.Equal("Late post", twts[1].Text)
+		assert.Equal(today, twts[1].Created.Format("2006-01-02"))
+	})
+}
@@ -4,7 +4,7 @@ go 1.14
 
 require (
 	github.com/JohannesKaufmann/html-to-markdown v1.3.0
-	github.com/PuerkitoBio/goquery v1.8.0 // indirect
+	github.com/PuerkitoBio/goquery v1.8.0
 	github.com/andyleap/microformats v0.0.0-20150523144534-25ae286f528b
 	github.com/aofei/cameron v1.1.6
 	github.com/badgerodon/ioutil v0.0.0-20150716134133-06e58e34b867
@@ -29,6 +29,6 @@ require (
 	github.com/stretchr/testify v1.8.1
 	go.mills.io/tasks v0.0.0-20221203225004-ed0b72b22ccc
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
-	golang.org/x/net v0.0.0-20211020060615-d418f374d309 // indirect
+	golang.org/x/net v0.0.0-20211020060615-d418f374d309
 	golang.org/x/text v0.3.7 // indirect
 )
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image/png"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -15,6 +18,7 @@ import (
 	"github.com/aofei/cameron"
 	"github.com/badgerodon/ioutil"
 	"github.com/gorilla/mux"
+	"github.com/mmcdole/gofeed"
 	"github.com/rickb777/accept"
 	log "github.com/sirupsen/logrus"
 )
@@ -97,6 +101,10 @@ func (app *App) IndexHandler(w http.ResponseWriter, r *http.Request) {
 			feed, err = ValidateRSSFeed(app.conf, uri)
 		case "mastodon":
 			feed, err = ValidateMastodonFeed(app.conf, u.Rest)
+		case "twtxt":
+			feed, err = ValidateTwtxtFeed(app.conf, uri)
+		case "gemini":
+			feed, err = ValidateGeminiFeed(app.conf, uri)
 		default:
 			if err := renderMessage(w, http.StatusBadRequest, "Error", "Unsupproted feed"); err != nil {
 				log.WithError(err).Error("error rendering message template")
@@ -132,7 +140,7 @@ func (app *App) IndexHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		app.tasks.DispatchFunc(func() error {
-			return UpdateRSSFeed(app.conf, feed.Name, feed.URI)
+			return UpdateFeed(app.conf, feed.Name, feed.URI)
 		})
 
 		msg := fmt.Sprintf("Feed successfully added %s: %s", feed.Name, feed.URI)
@@ -181,23 +189,16 @@ func (app *App) FeedHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
 		w.Header().Set("Last-Modified", fileInfo.ModTime().Format(http.TimeFormat))
 
-		if r.Method == http.MethodHead {
-			return
+		if app.hub != nil {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, app.hub.URL()))
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="self"`, URLForFeed(app.conf, name)))
 		}
 
-		ctx := map[string]string{
-			"Name":         feed.Name,
-			"URL":          fmt.Sprintf("%s/%s/twtxt.txt", app.conf.BaseURL, feed.Name),
-			"Type":         feed.Type,
-			"Source":       feed.URI,
-			"Avatar":       feed.Avatar,
-			"Description":  feed.Description,
-			"LastModified": fileInfo.ModTime().UTC().Format(time.RFC3339),
-
-			"SoftwareVersion": FullVersion(),
+		if r.Method == http.MethodHead {
+			return
 		}
 
-		preamble, err := RenderPlainText(preambleTemplate, ctx)
+		preamble, err := RenderPreamble(app.conf, feed, fileInfo.ModTime())
 		if err != nil {
 			log.WithError(err).Warn("error rendering twtxt preamble")
 		}
@@ -313,6 +314,104 @@ func (app *App) AvatarHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 }
 
+// TwtHandler serves a single twt of a feed by its twt hash along with a link
+// to its original source. Browsers are redirected to the source.
+func (app *App) TwtHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	name, hash := vars["name"], vars["hash"]
+	if name == "" || hash == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := app.conf.Feeds[name]; !ok {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+
+	twt, ok, err := app.index.Lookup(name, hash)
+	if err != nil {
+		log.WithError(err).Errorf("error looking up twt %s of %s", hash, name)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Twt not found", http.StatusNotFound)
+		return
+	}
+
+	link := TwtSourceLink(twt.Text)
+	if link != "" {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="original"`, link))
+	}
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="feed"`, URLForFeed(app.conf, name)))
+
+	if link != "" && accept.PreferredContentTypeLike(r.Header, "text/html") == "text/html" {
+		http.Redirect(w, r, link, http.StatusFound)
+		return
+	}
+
+	if accept.PreferredContentTypeLike(r.Header, "application/json") == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		json.NewEncoder(w).Encode(struct {
+			Hash    string    `json:"hash"`
+			Feed    string    `json:"feed"`
+			Created time.Time `json:"created"`
+			Text    string    `json:"text"`
+			Link    string    `json:"link,omitempty"`
+			Lang    string    `json:"lang,omitempty"`
+		}{hash, URLForFeed(app.conf, name), twt.Created, twt.Text, link, app.index.Language(name, hash)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	fmt.Fprintf(w, "%s\t%s\n", twt.Created.Format(time.RFC3339), twt.Text)
+}
+
+// MediaHandler serves the mirrored images of a feed's twts.
+func (app *App) MediaHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	name, filename := vars["name"], vars["file"]
+	if name == "" || filename == "" || filename != filepath.Base(filename) || strings.HasPrefix(filename, ".") {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := app.conf.Feeds[name]; !ok {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(MediaFile(app.conf, name, filename))
+	if err != nil {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		log.WithError(err).Error("os.Stat() error")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Media is named by the hash of its source so it never changes.
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, filename, fileInfo.ModTime(), f)
+}
+
 func (app *App) WeAreFeedsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodHead || r.Method == http.MethodGet {
 		w.Header().Set("Content-Type", "text/plain")
@@ -337,6 +436,42 @@ func (app *App) FeedsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if accept.PreferredContentTypeLike(r.Header, "application/json") == "application/json" {
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == http.MethodHead {
+				return
+			}
+
+			type feedJSON struct {
+				Name        string `json:"name"`
+				URL         string `json:"url"`
+				Source      string `json:"source,omitempty"`
+				Avatar      string `json:"avatar,omitempty"`
+				Description string `json:"description,omitempty"`
+				Link        string `json:"link,omitempty"`
+				Lang        string `json:"lang,omitempty"`
+			}
+
+			feeds := []feedJSON{}
+			for _, feed := range app.GetFeeds() {
+				f := feedJSON{
+					Name:        feed.Name,
+					URL:         feed.URI,
+					Avatar:      feed.Avatar,
+					Description: feed.Description,
+				}
+				if feedConfig, ok := app.conf.Feeds[feed.Name]; ok {
+					f.Source = feedConfig.URI
+					f.Link = feedConfig.Link
+					f.Lang = feedConfig.Lang
+				}
+				feeds = append(feeds, f)
+			}
+
+			json.NewEncoder(w).Encode(feeds)
+			return
+		}
+
 		w.Header().Set("Content-Type", "text/html")
 
 		ctx := struct {
@@ -359,3 +494,112 @@ func (app *App) FeedsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 }
+
+func (app *App) WebSubCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	feed, ok := app.conf.Feeds[name]
+	if !ok || feed.webSub == nil {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	sub := feed.webSub
+
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+
+		// Only our own pending subscription requests are verified (or denied).
+		if sub.Pending == "" {
+			http.Error(w, "No pending subscription", http.StatusNotFound)
+			return
+		}
+		if query.Get("hub.topic") != sub.Topic {
+			http.Error(w, "Topic mismatch", http.StatusNotFound)
+			return
+		}
+
+		switch query.Get("hub.mode") {
+		case "subscribe":
+			lease, err := strconv.Atoi(query.Get("hub.lease_seconds"))
+			if err != nil || lease <= 0 || lease > webSubLeaseSeconds {
+				lease = webSubLeaseSeconds
+			}
+			sub.Secret, sub.Pending = sub.Pending, ""
+			sub.Verified = true
+			sub.Expires = time.Now().Add(time.Duration(lease) * time.Second)
+			log.Infof("websub subscription for %s verified by %s until %s", name, sub.Hub, sub.Expires)
+		case "denied":
+			log.Warnf("websub subscription for %s denied by %s: %s", name, sub.Hub, query.Get("hub.reason"))
+			sub.Pending = ""
+			if !sub.Active(time.Now()) {
+				feed.webSub = nil
+			}
+		default:
+			// We never unsubscribe, so neither should anyone else on our behalf.
+			http.Error(w, "Unexpected mode", http.StatusNotFound)
+			return
+		}
+
+		if err := saveWebSub(app.conf, name, feed); err != nil {
+			log.WithError(err).Warnf("error saving websub subscription for %s", name)
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(query.Get("hub.challenge")))
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxFeedDocumentSize))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		// Content that fails verification is acknowledged but ignored, as
+		// per the WebSub spec.
+		if !VerifyWebSubSignature(sub.Secret, r.Header.Get("X-Hub-Signature"), body) {
+			log.Warnf("ignoring websub content for %s with an invalid signature", name)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		app.tasks.DispatchFunc(func() error {
+			pushed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+			if err != nil {
+				log.WithError(err).Warnf("error parsing websub content for %s", name)
+				return err
+			}
+			return ProcessRSSFeed(app.conf, name, feed.URI, pushed)
+		})
+
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+func (app *App) HubHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		err := app.hub.Request(
+			r.FormValue("hub.mode"),
+			r.FormValue("hub.topic"),
+			r.FormValue("hub.callback"),
+			r.FormValue("hub.secret"),
+			r.FormValue("hub.lease_seconds"),
+		)
+		if errors.Is(err, ErrHubBusy) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gosimple/slug"
+	"github.com/mmcdole/gofeed"
+)
+
+// FeedHashtags configures the hashtags generated from the categories of a
+// feed's items if enabled, only those allowed (or all if none are) and not
+// denied. Feeds have no hashtags unless they enable them.
+type FeedHashtags struct {
+	Enabled bool     `yaml:"enabled,omitempty"`
+	Allow   []string `yaml:"allow,omitempty"`
+	Deny    []string `yaml:"deny,omitempty"`
+}
+
+// NormalizeHashtag normalizes a category into a hashtag (without the #).
+func NormalizeHashtag(category string) string {
+	return slug.Make(category)
+}
+
+func containsHashtag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if NormalizeHashtag(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemHashtags returns the normalized hashtags of the `item`'s categories
+// allowed by the `feed`'s configuration, none unless the feed enables them.
+func ItemHashtags(feed *Feed, item *gofeed.Item) []string {
+	if feed == nil || feed.Hashtags == nil || !feed.Hashtags.Enabled {
+		return nil
+	}
+	hashtags := feed.Hashtags
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, category := range item.Categories {
+		tag := NormalizeHashtag(category)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		if len(hashtags.Allow) > 0 && !containsHashtag(hashtags.Allow, tag) {
+			continue
+		}
+		if containsHashtag(hashtags.Deny, tag) {
+			continue
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// FormatHashtags formats the `tags` that fit in `max` bytes as twtxt
+// hashtags, skipping those that do not fit in what is left.
+func FormatHashtags(tags []string, max int) string {
+	var sb strings.Builder
+	for _, tag := range tags {
+		if sb.Len()+len(tag)+2 > max {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString("#")
+		sb.WriteString(tag)
+	}
+	return sb.String()
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemHashtags(t *testing.T) {
+	item := &gofeed.Item{Categories: []string{"Go", "Machine Learning", "go", "Événements", "!!!"}}
+
+	assert.Nil(t, ItemHashtags(nil, item))
+	assert.Nil(t, ItemHashtags(&Feed{}, item))
+	assert.Equal(t, []string{"go", "machine-learning", "evenements"}, ItemHashtags(&Feed{Hashtags: &FeedHashtags{Enabled: true}}, item))
+	assert.Equal(t, []string{"machine-learning"}, ItemHashtags(&Feed{Hashtags: &FeedHashtags{Enabled: true, Allow: []string{"machine learning", "python"}}}, item))
+	assert.Equal(t, []string{"machine-learning", "evenements"}, ItemHashtags(&Feed{Hashtags: &FeedHashtags{Enabled: true, Deny: []string{"GO"}}}, item))
+	assert.Nil(t, ItemHashtags(&Feed{Hashtags: &FeedHashtags{Deny: []string{"GO"}}}, item))
+}
+
+func TestFormatHashtags(t *testing.T) {
+	tags := []string{"go", "machine-learning", "twtxt"}
+
+	assert.Equal(t, "#go #machine-learning #twtxt", FormatHashtags(tags, 100))
+	assert.Equal(t, "#go #twtxt", FormatHashtags(tags, 10))
+	assert.Equal(t, "#go", FormatHashtags(tags, 9))
+	assert.Equal(t, "", FormatHashtags(tags, 2))
+	assert.Equal(t, "", FormatHashtags(nil, 100))
+}
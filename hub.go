@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	hubDefaultLease = 7 * 24 * time.Hour
+	hubMinLease     = time.Hour
+	hubMaxLease     = 30 * 24 * time.Hour
+
+	// hubWorkers is the number of verifications and deliveries made at once
+	hubWorkers = 10
+
+	// hubQueueSize is the number of verifications and deliveries waiting on
+	// a worker, beyond which requests are refused and deliveries dropped
+	hubQueueSize = 100
+)
+
+var (
+	ErrHubInvalidTopic    = errors.New("error: topic is not a feed of this hub")
+	ErrHubInvalidCallback = errors.New("error: invalid callback url")
+	ErrHubInvalidMode     = errors.New("error: invalid hub.mode")
+	ErrHubBusy            = errors.New("error: hub is busy")
+)
+
+// HubSubscriber is a verified subscriber to one of our feeds.
+type HubSubscriber struct {
+	Callback string    `json:"callback"`
+	Secret   string    `json:"secret,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Hub is a WebSub hub for our own feeds, it verifies subscriptions and
+// distributes feeds to their subscribers when they are updated. Callbacks
+// are only ever requested from public addresses, so subscribers cannot make
+// us request our own or our network's services.
+type Hub struct {
+	mu     sync.RWMutex
+	saveMu sync.Mutex // serializes saves, which share a temporary file
+	conf   *Config
+	client *http.Client
+	jobs   chan func()
+
+	// allowPrivate allows callbacks on loopback, private and link-local
+	// addresses (for tests)
+	allowPrivate bool
+
+	// Subscribers maps feed names to callbacks to their subscribers
+	Subscribers map[string]map[string]*HubSubscriber `json:"subscribers"`
+}
+
+// NewHub returns a new hub for the feeds of `conf` with any subscribers
+// previously persisted in its data directory.
+func NewHub(conf *Config) (*Hub, error) {
+	hub := &Hub{
+		conf:        conf,
+		jobs:        make(chan func(), hubQueueSize),
+		Subscribers: make(map[string]map[string]*HubSubscriber),
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, Control: hub.control}
+	hub.client = &http.Client{
+		Timeout:   httpClient.Timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+
+	if err := LoadState(conf, "websub", "hub", hub); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < hubWorkers; i++ {
+		go func() {
+			for job := range hub.jobs {
+				job()
+			}
+		}()
+	}
+
+	return hub, nil
+}
+
+// publicIP returns true if the `ip` is a public unicast address.
+func publicIP(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// control refuses connections to callbacks on addresses that are not public,
+// checked as they are dialed so names cannot resolve to them later on.
+func (hub *Hub) control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !hub.allowPrivate && !publicIP(net.ParseIP(host)) {
+		return fmt.Errorf("%w: %s is not a public address", ErrHubInvalidCallback, host)
+	}
+	return nil
+}
+
+// dispatch queues the `job` for a worker, or returns false if the queue is
+// full.
+func (hub *Hub) dispatch(job func()) bool {
+	select {
+	case hub.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// URL returns the URL of the hub.
+func (hub *Hub) URL() string {
+	return fmt.Sprintf("%s/websub", strings.TrimSuffix(hub.conf.BaseURL, "/"))
+}
+
+// FeedForTopic returns the name of our feed for the `topic` URL.
+func (hub *Hub) FeedForTopic(topic string) (string, error) {
+	prefix := strings.TrimSuffix(hub.conf.BaseURL, "/") + "/"
+	if !strings.HasPrefix(topic, prefix) || !strings.HasSuffix(topic, "/twtxt.txt") {
+		return "", ErrHubInvalidTopic
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(topic, prefix), "/twtxt.txt")
+	if _, ok := hub.conf.Feeds[name]; !ok || strings.Contains(name, "/") {
+		return "", ErrHubInvalidTopic
+	}
+
+	return name, nil
+}
+
+func (hub *Hub) save() error {
+	hub.saveMu.Lock()
+	defer hub.saveMu.Unlock()
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return SaveState(hub.conf, "websub", "hub", hub)
+}
+
+// Request handles a (un)subscription request, validating it before verifying
+// the subscriber's intent asynchronously as per the WebSub spec.
+func (hub *Hub) Request(mode, topic, callback, secret, leaseSeconds string) error {
+	if mode != "subscribe" && mode != "unsubscribe" {
+		return ErrHubInvalidMode
+	}
+
+	name, err := hub.FeedForTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrHubInvalidCallback
+	}
+	if !hub.allowPrivate {
+		if ip := net.ParseIP(u.Hostname()); (ip != nil && !publicIP(ip)) || strings.EqualFold(u.Hostname(), "localhost") {
+			return ErrHubInvalidCallback
+		}
+	}
+
+	lease := hubDefaultLease
+	if seconds, err := strconv.Atoi(leaseSeconds); err == nil && seconds > 0 {
+		lease = time.Duration(seconds) * time.Second
+	}
+	if lease < hubMinLease {
+		lease = hubMinLease
+	}
+	if lease > hubMaxLease {
+		lease = hubMaxLease
+	}
+
+	ok := hub.dispatch(func() {
+		if err := hub.verify(mode, name, topic, callback, secret, lease); err != nil {
+			log.WithError(err).Warnf("error verifying websub %s of %s for %s", mode, callback, name)
+		}
+	})
+	if !ok {
+		return ErrHubBusy
+	}
+
+	return nil
+}
+
+func (hub *Hub) verify(mode, name, topic, callback, secret string, lease time.Duration) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	challenge := hex.EncodeToString(nonce)
+
+	u, err := url.Parse(callback)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("hub.mode", mode)
+	query.Set("hub.topic", topic)
+	query.Set("hub.challenge", challenge)
+	if mode == "subscribe" {
+		query.Set("hub.lease_seconds", strconv.Itoa(int(lease.Seconds())))
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("feeds/%s", FullVersion()))
+
+	res, err := hub.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("error: unexpected response %s", res.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != challenge {
+		return fmt.Errorf("error: callback did not echo our challenge")
+	}
+
+	hub.mu.Lock()
+	subscribers := hub.Subscribers[name]
+	if subscribers == nil {
+		subscribers = make(map[string]*HubSubscriber)
+		hub.Subscribers[name] = subscribers
+	}
+	if mode == "subscribe" {
+		subscribers[callback] = &HubSubscriber{
+			Callback: callback,
+			Secret:   secret,
+			Expires:  time.Now().Add(lease),
+		}
+	} else {
+		delete(subscribers, callback)
+	}
+	hub.mu.Unlock()
+
+	log.Infof("websub %s of %s for %s verified", mode, callback, name)
+
+	return hub.save()
+}
+
+// Publish distributes the feed `name` to its subscribers, expired
+// subscriptions are pruned.
+func (hub *Hub) Publish(name string) {
+	hub.mu.Lock()
+	var subscribers []*HubSubscriber
+	pruned := false
+	now := time.Now()
+	for callback, subscriber := range hub.Subscribers[name] {
+		if now.After(subscriber.Expires) {
+			delete(hub.Subscribers[name], callback)
+			pruned = true
+			continue
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	hub.mu.Unlock()
+
+	if pruned {
+		if err := hub.save(); err != nil {
+			log.WithError(err).Warn("error saving websub hub")
+		}
+	}
+
+	if len(subscribers) == 0 {
+		return
+	}
+
+	feed, ok := hub.conf.Feeds[name]
+	if !ok {
+		return
+	}
+
+	fn := filepath.Join(hub.conf.DataDir, fmt.Sprintf("%s.txt", name))
+	stat, err := os.Stat(fn)
+	if err != nil {
+		log.WithError(err).Warnf("error publishing %s", name)
+		return
+	}
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		log.WithError(err).Warnf("error publishing %s", name)
+		return
+	}
+
+	preamble, err := RenderPreamble(hub.conf, feed, stat.ModTime())
+	if err != nil {
+		log.WithError(err).Warn("error rendering twtxt preamble")
+	}
+	content := append([]byte(preamble), data...)
+
+	for _, subscriber := range subscribers {
+		subscriber := subscriber
+		ok := hub.dispatch(func() {
+			if err := hub.deliver(name, subscriber, content); err != nil {
+				log.WithError(err).Warnf("error delivering %s to %s", name, subscriber.Callback)
+			}
+		})
+		if !ok {
+			log.Warnf("hub is busy, dropped delivery of %s to %s", name, subscriber.Callback)
+		}
+	}
+}
+
+func (hub *Hub) deliver(name string, subscriber *HubSubscriber, content []byte) error {
+	req, err := http.NewRequest(http.MethodPost, subscriber.Callback, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", fmt.Sprintf("feeds/%s", FullVersion()))
+	req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, hub.URL()))
+	req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="self"`, URLForFeed(hub.conf, name)))
+
+	if subscriber.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(subscriber.Secret))
+		mac.Write(content)
+		req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := hub.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusGone {
+		hub.mu.Lock()
+		delete(hub.Subscribers[name], subscriber.Callback)
+		hub.mu.Unlock()
+		return hub.save()
+	}
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("error: unexpected response %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["example"] = &Feed{Name: "example", Type: FeedTypeRSS}
+	require.NoError(os.WriteFile(filepath.Join(conf.DataDir, "example.txt"), []byte("2021-01-01T00:00:00Z\tHello\n"), 0644))
+
+	hub, err := NewHub(conf)
+	require.NoError(err)
+	conf.hub = hub
+
+	verified := make(chan url.Values, 1)
+	pushed := make(chan *http.Request, 1)
+	pushedBody := make(chan string, 1)
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			verified <- r.URL.Query()
+			w.Write([]byte(r.URL.Query().Get("hub.challenge")))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		pushed <- r
+		pushedBody <- string(body)
+	}))
+	defer subscriber.Close()
+
+	topic := "https://feeds.example.com/example/twtxt.txt"
+
+	assert.ErrorIs(hub.Request("subscribe", "https://elsewhere.example.com/twtxt.txt", subscriber.URL, "", ""), ErrHubInvalidTopic)
+	assert.ErrorIs(hub.Request("subscribe", "https://feeds.example.com/missing/twtxt.txt", subscriber.URL, "", ""), ErrHubInvalidTopic)
+	assert.ErrorIs(hub.Request("subscribe", topic, "ftp://example.com", "", ""), ErrHubInvalidCallback)
+	assert.ErrorIs(hub.Request("publish", topic, subscriber.URL, "", ""), ErrHubInvalidMode)
+
+	// Callbacks on addresses that are not public are refused, also when
+	// dialed after resolving their names.
+	for _, callback := range []string{subscriber.URL, "http://localhost/", "http://10.0.0.1/", "http://[::1]/", "http://169.254.169.254/"} {
+		assert.ErrorIs(hub.Request("subscribe", topic, callback, "", ""), ErrHubInvalidCallback, callback)
+	}
+	assert.ErrorIs(hub.control("tcp", "127.0.0.1:80", nil), ErrHubInvalidCallback)
+	assert.ErrorIs(hub.control("tcp", "192.168.1.1:443", nil), ErrHubInvalidCallback)
+	assert.NoError(hub.control("tcp", "93.184.216.34:443", nil))
+
+	hub.allowPrivate = true
+	require.NoError(hub.Request("subscribe", topic, subscriber.URL, "secret", "60"))
+
+	select {
+	case query := <-verified:
+		assert.Equal("subscribe", query.Get("hub.mode"))
+		assert.Equal(topic, query.Get("hub.topic"))
+		assert.Equal("3600", query.Get("hub.lease_seconds"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for verification of intent")
+	}
+
+	require.Eventually(func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		return len(hub.Subscribers["example"]) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Subscribers are persisted.
+	reloaded, err := NewHub(conf)
+	require.NoError(err)
+	assert.Len(reloaded.Subscribers["example"], 1)
+
+	conf.NotifyFeedUpdated("example")
+
+	select {
+	case r := <-pushed:
+		body := <-pushedBody
+		assert.True(strings.HasPrefix(r.Header.Get("X-Hub-Signature"), "sha256="))
+		assert.True(VerifyWebSubSignature("secret", r.Header.Get("X-Hub-Signature"), []byte(body)))
+		assert.Contains(r.Header.Values("Link"), `<https://feeds.example.com/websub>; rel="hub"`)
+		assert.Contains(body, "# nick        = example")
+		assert.Contains(body, "2021-01-01T00:00:00Z\tHello\n")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for content distribution")
+	}
+
+	// Expired subscribers are pruned, also from the persisted subscribers.
+	hub.mu.Lock()
+	hub.Subscribers["example"][subscriber.URL].Expires = time.Now().Add(-time.Minute)
+	hub.mu.Unlock()
+	hub.Publish("example")
+
+	reloaded, err = NewHub(conf)
+	require.NoError(err)
+	assert.Empty(reloaded.Subscribers["example"])
+}
+
+func TestFeedHandlerAdvertisesHub(t *testing.T) {
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["example"] = &Feed{Name: "example", Type: FeedTypeRSS}
+	require.NoError(t, os.WriteFile(filepath.Join(conf.DataDir, "example.txt"), []byte("2021-01-01T00:00:00Z\tHello\n"), 0644))
+
+	hub, err := NewHub(conf)
+	require.NoError(t, err)
+
+	app := &App{conf: conf, hub: hub}
+	router := app.initRoutes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/example/twtxt.txt", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{
+		`<https://feeds.example.com/websub>; rel="hub"`,
+		`<https://feeds.example.com/example/twtxt.txt>; rel="self"`,
+	}, w.Header().Values("Link"))
+}
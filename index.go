@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var twtSourceLink = regexp.MustCompile(`\[Read more\]\(([^)\s]+)\)$`)
+
+// TwtSourceLink returns the link to the original source of a twt's `text`,
+// if it has one.
+func TwtSourceLink(text string) string {
+	if match := twtSourceLink.FindStringSubmatch(text); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// feedIndex is the index of the twts of a feed and their languages by their
+// twt hashes as of the last modification of the feed and its languages.
+type feedIndex struct {
+	modTime     time.Time
+	langModTime time.Time
+	twts        map[string]Twt
+	langs       map[string]string
+}
+
+// TwtIndex indexes the twts of our feeds, including rotated ones, by their
+// twt hashes. A feed is (re)indexed when it is looked up after it changed.
+type TwtIndex struct {
+	mu    sync.Mutex
+	conf  *Config
+	feeds map[string]*feedIndex
+}
+
+// NewTwtIndex returns a new index of the twts of the feeds of `conf`.
+func NewTwtIndex(conf *Config) *TwtIndex {
+	return &TwtIndex{
+		conf:  conf,
+		feeds: make(map[string]*feedIndex),
+	}
+}
+
+// Lookup returns the twt of the feed `name` with the twt hash `hash`.
+func (index *TwtIndex) Lookup(name, hash string) (Twt, bool, error) {
+	fn := filepath.Join(index.conf.DataDir, fmt.Sprintf("%s.txt", name))
+	stat, err := os.Stat(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Twt{}, false, nil
+		}
+		return Twt{}, false, err
+	}
+
+	var langModTime time.Time
+	if stat, err := os.Stat(StateFile(index.conf, name, "langs")); err == nil {
+		langModTime = stat.ModTime()
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	feed, ok := index.feeds[name]
+	if !ok || !feed.modTime.Equal(stat.ModTime()) {
+		if feed, err = index.build(name, fn, stat.ModTime()); err != nil {
+			return Twt{}, false, err
+		}
+		index.feeds[name] = feed
+	}
+	if !feed.langModTime.Equal(langModTime) || feed.langs == nil {
+		feed.langs = make(map[string]string)
+		if err := LoadState(index.conf, name, "langs", &feed.langs); err != nil {
+			return Twt{}, false, err
+		}
+		feed.langModTime = langModTime
+	}
+
+	twt, ok := feed.twts[hash]
+	return twt, ok, nil
+}
+
+// Language returns the language of the twt of the feed `name` with the twt
+// hash `hash` looked up last, or the language of the feed if it is not known.
+func (index *TwtIndex) Language(name, hash string) string {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if feed, ok := index.feeds[name]; ok {
+		if lang, ok := feed.langs[hash]; ok {
+			return lang
+		}
+	}
+
+	if feed := index.conf.Feeds[name]; feed != nil {
+		return feed.Lang
+	}
+	return ""
+}
+
+func (index *TwtIndex) build(name, fn string, modTime time.Time) (*feedIndex, error) {
+	url := URLForFeed(index.conf, name)
+	feed := &feedIndex{modTime: modTime, twts: make(map[string]Twt)}
+
+	err := readFeedTwts(fn, func(twt Twt) {
+		feed.twts[twt.Hash(url)] = twt
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// readFeedTwts calls `f` with each twt of the feed file `fn` and its archives.
+func readFeedTwts(fn string, f func(twt Twt)) error {
+	archives, err := filepath.Glob(fn + ".*")
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range append(archives, fn) {
+		twts, err := ReadTwts(fn)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", fn, err)
+		}
+		for _, twt := range twts {
+			f(twt)
+		}
+	}
+
+	return nil
+}
+
+// feedTwtHashes returns the twt hashes of the twts of the feed `name` and its
+// archives.
+func feedTwtHashes(conf *Config, name string) (map[string]bool, error) {
+	url := URLForFeed(conf, name)
+	hashes := make(map[string]bool)
+
+	err := readFeedTwts(filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name)), func(twt Twt) {
+		hashes[twt.Hash(url)] = true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwtSourceLink(t *testing.T) {
+	assert.Equal(t, "https://example.com/hello", TwtSourceLink("**Hello** ⌘ [Read more](https://example.com/hello)"))
+	assert.Equal(t, "", TwtSourceLink("Just a twt with a [link](https://example.com/)"))
+}
+
+func TestTwtHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["example"] = &Feed{Name: "example"}
+
+	fn := filepath.Join(conf.DataDir, "example.txt")
+	require.NoError(os.WriteFile(fn+".1609459200", []byte("2020-12-31T00:00:00Z\tOld twt\n"), 0644))
+	require.NoError(os.WriteFile(fn, []byte("2021-01-01T00:00:00Z\t**Hello** ⌘ [Read more](https://example.com/hello)\n"), 0644))
+
+	url := URLForFeed(conf, "example")
+	hello := TwtHash(url, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), "**Hello** ⌘ [Read more](https://example.com/hello)")
+	old := TwtHash(url, time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), "Old twt")
+
+	app := &App{conf: conf, index: NewTwtIndex(conf)}
+	router := app.initRoutes()
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/example/twt/"+hello, "")
+	require.Equal(http.StatusOK, w.Code)
+	assert.Equal("2021-01-01T00:00:00Z\t**Hello** ⌘ [Read more](https://example.com/hello)\n", w.Body.String())
+	assert.Contains(w.Header().Values("Link"), `<https://example.com/hello>; rel="original"`)
+
+	w = get("/example/twt/"+hello, "text/html,application/xhtml+xml,*/*;q=0.8")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://example.com/hello", w.Header().Get("Location"))
+
+	w = get("/example/twt/"+hello, "application/json")
+	require.Equal(http.StatusOK, w.Code)
+	var body map[string]string
+	require.NoError(json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(hello, body["hash"])
+	assert.Equal(url, body["feed"])
+	assert.Equal("https://example.com/hello", body["link"])
+
+	// Twts of rotated feeds are indexed too.
+	w = get("/example/twt/"+old, "text/html")
+	require.Equal(http.StatusOK, w.Code)
+	assert.Equal("2020-12-31T00:00:00Z\tOld twt\n", w.Body.String())
+
+	assert.Equal(http.StatusNotFound, get("/example/twt/abcdefg", "").Code)
+	assert.Equal(http.StatusNotFound, get("/missing/twt/"+hello, "").Code)
+
+	// The index is refreshed when the feed changes.
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(err)
+	require.NoError(AppendTwt(f, "New twt", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)))
+	require.NoError(f.Close())
+	require.NoError(os.Chtimes(fn, time.Now(), time.Now().Add(time.Minute)))
+
+	assert.Equal(http.StatusOK, get("/example/twt/"+TwtHash(url, time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), "New twt"), "").Code)
+}
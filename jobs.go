@@ -1,12 +1,9 @@
 package main
 
 import (
-	"fmt"
 	"os"
-	"path/filepath"
 	"time"
 
-	"github.com/divan/num2words"
 	"github.com/dustin/go-humanize"
 	"github.com/robfig/cron"
 	log "github.com/sirupsen/logrus"
@@ -31,7 +28,7 @@ func init() {
 	Jobs = map[string]JobSpec{
 		"RotateFeeds": NewJobSpec("@hourly", NewRotateFeedsJob),
 		"UpdateFeeds": NewJobSpec("@every 5m", NewUpdateFeedsJob),
-		"TikTokBot":   NewJobSpec("0 0,30 * * * *", NewTikTokJob),
+		"RenewWebSub": NewJobSpec("@hourly", NewRenewWebSubJob),
 	}
 
 	StartupJobs = map[string]JobSpec{
@@ -90,137 +87,69 @@ func NewUpdateFeedsJob(conf *Config) cron.Job {
 
 func (job *UpdateFeedsJob) Run() {
 	conf := job.conf
+	now := time.Now()
 	for name, feed := range conf.Feeds {
-		if feed.URI == "" {
+		if feed.URI == "" || feed.Schedule != "" {
 			continue
 		}
 
-		u, err := ParseURI(feed.URI)
-		if err != nil {
-			log.WithError(err).Errorf("error parsing feed %s: %s", name, feed.URI)
+		// Feeds with an active WebSub subscription are pushed to us, they
+		// are only polled again once their lease lapses.
+		if feed.webSub.Active(now) {
 			continue
 		}
 
-		switch u.Type {
-		case "rss", "http", "https":
-			if err := UpdateRSSFeed(conf, name, feed.URI); err != nil {
-				log.WithError(err).Errorf("error updating rss feed %s: %s", name, feed.URI)
-			}
-		default:
-			log.Warnf("error unknown feed type %s: %s", name, feed.URI)
+		if err := UpdateFeed(conf, name, feed.URI); err != nil {
+			log.WithError(err).Errorf("error updating feed %s: %s", name, feed.URI)
 		}
 	}
 }
 
-type TikTokJob struct {
-	conf    *Config
-	name    string
-	url     string
-	symbols map[int]string
+// UpdateFeedJob updates a single feed that has its own `schedule`.
+type UpdateFeedJob struct {
+	conf *Config
+	name string
 }
 
-func NewTikTokJob(conf *Config) cron.Job {
-	symbols := map[int]string{
-		0: "🕛", 30: "🕧",
-		100: "🕐", 130: "🕜",
-		200: "🕑", 230: "🕝",
-		300: "🕒", 330: "🕞",
-		400: "🕓", 430: "🕟",
-		500: "🕔", 530: "🕠",
-		600: "🕕", 630: "🕡",
-		700: "🕖", 730: "🕢",
-		800: "🕗", 830: "🕣",
-		900: "🕘", 930: "🕤",
-		1000: "🕙", 1030: "🕥",
-		1100: "🕚", 1130: "🕦",
-		1200: "🕛", 1230: "🕧",
-	}
-
-	name := "tiktok"
-	url := fmt.Sprintf("@<%s %s>", name, URLForFeed(conf, name))
+func NewUpdateFeedJob(conf *Config, name string) cron.Job {
+	return &UpdateFeedJob{conf: conf, name: name}
+}
 
-	feed := &Feed{
-		Name: name,
-		Type: FeedTypeBot,
-		Description: fmt.Sprintf(
-			"I am @%s an automated feed that twts every 30m with the current time (UTC)",
-			name,
-		),
+func (job *UpdateFeedJob) Run() {
+	feed, ok := job.conf.Feeds[job.name]
+	if !ok || feed.URI == "" {
+		return
 	}
 
-	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.png", feed.Name))
-	if Exists(fn) && feed.Avatar == "" {
-		feed.Avatar = fmt.Sprintf("%s/%s/avatar.png", conf.BaseURL, feed.Name)
-		if avatarHash, err := FastHashFile(fn); err == nil {
-			feed.Avatar += "#" + avatarHash
-		} else {
-			log.WithError(err).Warnf("error updating avatar hash for %s", feed.Name)
-		}
+	if err := UpdateFeed(job.conf, job.name, feed.URI); err != nil {
+		log.WithError(err).Errorf("error updating feed %s: %s", job.name, feed.URI)
 	}
+}
 
-	conf.Feeds[name] = feed
+// RenewWebSubJob renews WebSub subscriptions whose leases are about to lapse.
+type RenewWebSubJob struct {
+	conf *Config
+}
 
-	return &TikTokJob{
-		conf:    conf,
-		name:    name,
-		url:     url,
-		symbols: symbols,
-	}
+func NewRenewWebSubJob(conf *Config) cron.Job {
+	return &RenewWebSubJob{conf: conf}
 }
 
-func (job *TikTokJob) Run() {
+func (job *RenewWebSubJob) Run() {
 	conf := job.conf
-
-	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", job.name))
-
-	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-	if err != nil {
-		log.WithError(err).Error("error opening file for writing")
+	if !conf.WebSub {
 		return
 	}
-	defer f.Close()
 
-	now := time.Now().UTC()
-
-	hour := now.Hour() % 12
-	min := now.Minute()
-
-	var key int
-
-	if hour == 0 {
-		key = hour + min
-	} else {
-		key = (hour * 100) + min
-	}
-	sym := job.symbols[key]
-
-	var clock string
-
-	if hour == 0 {
-		clock = "twelve"
-	} else {
-		clock = num2words.Convert(hour)
-	}
-
-	if min == 0 {
-		clock += " o'clock"
-	} else if min == 30 {
-		clock += " thirty"
-	} else {
-		clock = fmt.Sprintf("%s past %s", num2words.Convert(min), clock)
-	}
-
-	if now.Hour() < 6 {
-		clock += " in the morning 😴"
-	} else if now.Hour() < 12 {
-		clock += " 🌞"
-	} else if now.Hour() < 18 {
-		clock += " in the afternoon 🌅"
-	} else {
-		clock += " in the evening 🌛"
-	}
+	now := time.Now()
+	for name, feed := range conf.Feeds {
+		sub := feed.webSub
+		if sub == nil || !sub.NeedsRenewal(now) {
+			continue
+		}
 
-	if err := AppendTwt(f, fmt.Sprintf("%s The time is now %s", sym, clock)); err != nil {
-		log.WithError(err).Error("error writing @tiktok feed")
+		if err := SubscribeWebSub(conf, name, sub.Hub, sub.Topic); err != nil {
+			log.WithError(err).Errorf("error renewing websub subscription for %s", name)
+		}
 	}
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// ItemLang is the key of an item's `Custom` data holding its language.
+const ItemLang = "lang"
+
+// minLanguageEvidence is the least number of stopwords (or letters of a
+// script) text must have for its language to be detected.
+const minLanguageEvidence = 2
+
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// scriptLanguages are the languages detected by the script they are written
+// in, in order of precedence.
+var scriptLanguages = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"ru", unicode.Cyrillic},
+	{"el", unicode.Greek},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+	{"th", unicode.Thai},
+	{"hi", unicode.Devanagari},
+}
+
+// stopwords are common words of languages written in Latin script.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "on", "are", "this", "you", "be", "have", "not"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "auf", "für", "ich", "auch", "es", "von"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "un", "du", "pour", "dans", "que", "qui", "pas", "sur", "avec", "au", "ce"},
+	"es": {"el", "la", "los", "las", "y", "de", "que", "en", "es", "por", "para", "una", "con", "no", "del", "se", "lo", "como"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "non", "sono", "del", "della", "con", "gli", "le", "è", "anche", "come"},
+	"pt": {"o", "a", "os", "as", "e", "de", "que", "do", "da", "em", "um", "uma", "para", "não", "com", "é", "se", "por"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "ook", "maar", "er", "als", "wel"},
+	"sv": {"och", "att", "det", "som", "en", "är", "på", "för", "med", "inte", "av", "till", "jag", "den", "har", "om", "ett", "var"},
+}
+
+var stopwordLanguages = func() map[string][]string {
+	languages := make(map[string][]string)
+	for lang, words := range stopwords {
+		for _, word := range words {
+			languages[word] = append(languages[word], lang)
+		}
+	}
+	return languages
+}()
+
+// DetectLanguage returns the language (ISO 639-1 code) of the `text`, which
+// may be HTML, or an empty string if it can not be told. Languages are told
+// apart by their script and for Latin script by their most common words.
+func DetectLanguage(text string) string {
+	text = html.UnescapeString(htmlTags.ReplaceAllString(text, " "))
+
+	scripts := make(map[string]int)
+	latin := 0
+	for _, r := range text {
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, script := range scriptLanguages {
+			if unicode.Is(script.table, r) {
+				scripts[script.lang]++
+				break
+			}
+		}
+	}
+
+	for _, script := range scriptLanguages {
+		if n := scripts[script.lang]; n >= minLanguageEvidence && n >= latin {
+			if script.lang == "ru" && strings.ContainsAny(text, "іїєґІЇЄҐ") {
+				return "uk"
+			}
+			return script.lang
+		}
+	}
+
+	scores := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		for _, lang := range stopwordLanguages[word] {
+			scores[lang]++
+		}
+	}
+
+	return bestLanguage(scores)
+}
+
+// bestLanguage returns the language with the highest score if it is high
+// enough and unambiguous.
+func bestLanguage(scores map[string]int) string {
+	var langs []string
+	for lang := range scores {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if scores[langs[i]] != scores[langs[j]] {
+			return scores[langs[i]] > scores[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+
+	if len(langs) == 0 || scores[langs[0]] < minLanguageEvidence {
+		return ""
+	}
+	if len(langs) > 1 && scores[langs[1]] == scores[langs[0]] {
+		return ""
+	}
+	return langs[0]
+}
+
+// ItemLanguage returns the language of the `item`, as declared by its feed
+// or otherwise detected from its title and content, and records it.
+func ItemLanguage(item *gofeed.Item) string {
+	if lang := item.Custom[ItemLang]; lang != "" {
+		return lang
+	}
+
+	lang := DetectLanguage(strings.Join([]string{item.Title, item.Description, item.Content}, " "))
+	if lang != "" {
+		if item.Custom == nil {
+			item.Custom = make(map[string]string)
+		}
+		item.Custom[ItemLang] = lang
+	}
+
+	return lang
+}
+
+// SetItemsLanguage sets the language of the `items` detected from their
+// title and content, or otherwise to the language `lang` declared by their
+// feed, if any, and returns the language of the feed, the declared one or
+// otherwise the most common language of its items.
+func SetItemsLanguage(items []*gofeed.Item, lang string) string {
+	lang = normalizeLang(lang)
+
+	scores := make(map[string]int)
+	for _, item := range items {
+		if l := ItemLanguage(item); l != "" {
+			scores[l]++
+			continue
+		}
+		if lang != "" {
+			if item.Custom == nil {
+				item.Custom = make(map[string]string)
+			}
+			item.Custom[ItemLang] = lang
+		}
+	}
+
+	if lang != "" {
+		return lang
+	}
+
+	return bestLanguage(scores)
+}
+
+// AllowLanguage returns true if the feed allows items in the language `lang`,
+// if it only allows some languages items of unknown language are allowed.
+func (feed *Feed) AllowLanguage(lang string) bool {
+	if feed == nil || len(feed.Languages) == 0 || lang == "" {
+		return true
+	}
+
+	for _, l := range feed.Languages {
+		if languageMatches(l, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// languageMatches returns true if the language tags `a` and `b` are the same
+// language ignoring regions, so `en` matches `en-US`.
+func languageMatches(a, b string) bool {
+	base := func(lang string) string {
+		lang = normalizeLang(lang)
+		if i := strings.Index(lang, "-"); i != -1 {
+			return lang[:i]
+		}
+		return lang
+	}
+	return base(a) == base(b)
+}
+
+// recordLanguages remembers the languages of the twts of the feed `name` by
+// their twt hashes, forgetting those of twts no longer in the feed or its
+// archives.
+func recordLanguages(conf *Config, name string, langs map[string]string) error {
+	if len(langs) == 0 {
+		return nil
+	}
+
+	states := make(map[string]string)
+	if err := LoadState(conf, name, "langs", &states); err != nil {
+		return err
+	}
+
+	hashes, err := feedTwtHashes(conf, name)
+	if err != nil {
+		return err
+	}
+	for hash := range states {
+		if !hashes[hash] {
+			delete(states, hash)
+		}
+	}
+
+	for hash, lang := range langs {
+		states[hash] = lang
+	}
+
+	return SaveState(conf, name, "langs", states)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	for expected, text := range map[string]string{
+		"en": "<p>This is the story of a feed that was aggregated with many others.</p>",
+		"de": "Das ist die Geschichte eines Feeds, der mit vielen anderen zusammengeführt wird und nicht allein ist.",
+		"fr": "C'est l'histoire d'un flux qui est agrégé avec les autres dans une liste pour le lecteur.",
+		"es": "Esta es la historia de un feed que se agrega con los otros para una lista del lector.",
+		"nl": "Dit is het verhaal van een feed die met de andere wordt samengevoegd en dat is niet erg.",
+		"ja": "これはフィードの物語です。",
+		"zh": "这是一个订阅源的故事。",
+		"ko": "이것은 피드의 이야기입니다.",
+		"ru": "Это история о ленте новостей.",
+		"uk": "Це історія про стрічку новин.",
+		"":   "Go 1.17",
+	} {
+		assert.Equal(t, expected, DetectLanguage(text), text)
+	}
+}
+
+func TestSetItemsLanguage(t *testing.T) {
+	en := &gofeed.Item{Title: "The news of the day", Description: "What is in the news and what is not"}
+	de := &gofeed.Item{Title: "Die Nachrichten des Tages", Description: "Was ist in den Nachrichten und was nicht"}
+	unknown := &gofeed.Item{Title: "v1.2.3"}
+
+	assert.Equal(t, "en", SetItemsLanguage([]*gofeed.Item{en, de, unknown, {Title: "This is the end of it"}}, ""))
+	assert.Equal(t, "de", de.Custom[ItemLang])
+	assert.Equal(t, "", unknown.Custom[ItemLang])
+
+	// The language declared by the feed is only that of items whose language
+	// is not detected.
+	de = &gofeed.Item{Title: "Die Nachrichten des Tages", Description: "Was ist in den Nachrichten und was nicht"}
+	assert.Equal(t, "fr-CA", SetItemsLanguage([]*gofeed.Item{de, unknown}, "fr_ca"))
+	assert.Equal(t, "de", de.Custom[ItemLang])
+	assert.Equal(t, "fr-CA", unknown.Custom[ItemLang])
+}
+
+func TestAllowLanguage(t *testing.T) {
+	feed := &Feed{Languages: []string{"en", "de-AT"}}
+
+	assert.True(t, feed.AllowLanguage("en"))
+	assert.True(t, feed.AllowLanguage("en-GB"))
+	assert.True(t, feed.AllowLanguage("de"))
+	assert.True(t, feed.AllowLanguage(""))
+	assert.False(t, feed.AllowLanguage("fr"))
+	assert.True(t, (&Feed{}).AllowLanguage("fr"))
+}
+
+func TestLanguages(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["example"] = &Feed{Name: "example", URI: "https://example.com/rss.xml", Languages: []string{"en"}, Lang: "en"}
+
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := []*gofeed.Item{
+		{Title: "Hello", Description: "This is the first post of the year", PublishedParsed: &published},
+		{Title: "Hallo", Description: "Das ist der erste Beitrag des Jahres und nicht der letzte", PublishedParsed: &published},
+	}
+	require.NoError(WriteFeedItems(conf, "example", items))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "example.txt"))
+	require.NoError(err)
+	require.Len(twts, 1)
+	assert.Contains(twts[0].Text, "Hello")
+
+	hash := twts[0].Hash(URLForFeed(conf, "example"))
+	langs := make(map[string]string)
+	require.NoError(LoadState(conf, "example", "langs", &langs))
+	assert.Equal(map[string]string{hash: "en"}, langs)
+
+	app := &App{conf: conf, index: NewTwtIndex(conf)}
+	router := app.initRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/example/twt/"+hash, nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+
+	var twt map[string]string
+	require.NoError(json.NewDecoder(w.Body).Decode(&twt))
+	assert.Equal("en", twt["lang"])
+
+	req = httptest.NewRequest(http.MethodGet, "/feeds", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(http.StatusOK, w.Code)
+
+	var feeds []map[string]string
+	require.NoError(json.NewDecoder(w.Body).Decode(&feeds))
+	require.Len(feeds, 1)
+	assert.Equal("example", feeds[0]["name"])
+	assert.Equal("en", feeds[0]["lang"])
+	assert.Equal("https://example.com/rss.xml", feeds[0]["source"])
+
+	// The languages of twts no longer in the feed (or its archives) are
+	// forgotten.
+	require.NoError(RotateFile(filepath.Join(conf.DataDir, "example.txt")))
+	require.NoError(SaveState(conf, "example", "langs", map[string]string{hash: "en", "gone": "de"}))
+
+	later := published.Add(time.Hour)
+	require.NoError(WriteFeedItems(conf, "example", []*gofeed.Item{
+		{Title: "Again", Description: "This is the second post of the year", PublishedParsed: &later},
+	}))
+
+	langs = make(map[string]string)
+	require.NoError(LoadState(conf, "example", "langs", &langs))
+	assert.Len(langs, 2)
+	assert.Equal("en", langs[hash])
+	assert.NotContains(langs, "gone")
+}
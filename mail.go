@@ -0,0 +1,569 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// mailMaxMessageSize is the maximum size of a message we consider
+	mailMaxMessageSize = 1 << 24 // 16MB
+
+	imapTimeout = time.Minute
+)
+
+var (
+	ErrIMAPCommandFailed = errors.New("error: imap command failed")
+)
+
+// mailState is the state kept between updates of a mail source, the messages
+// that have been published already: the unique names of the messages of a
+// maildir still in it, or the UIDVALIDITY of an IMAP mailbox and the highest
+// UID of its messages.
+type mailState struct {
+	Seen        []string `json:"seen,omitempty"`
+	UIDValidity uint32   `json:"uidvalidity,omitempty"`
+	UID         uint32   `json:"uid,omitempty"`
+}
+
+// MailFilter selects the messages of a mail source that belong to a feed, by
+// sender and/or mailing list.
+type MailFilter struct {
+	From string
+	List string
+}
+
+// Match returns true if the message with header `h` matches the filter.
+func (mf MailFilter) Match(h mail.Header) bool {
+	if mf.From != "" {
+		from := strings.ToLower(h.Get("From"))
+		if addr, err := mail.ParseAddress(h.Get("From")); err == nil {
+			from = strings.ToLower(addr.Address)
+		}
+		if !strings.Contains(from, strings.ToLower(mf.From)) {
+			return false
+		}
+	}
+	if mf.List != "" {
+		if !strings.Contains(strings.ToLower(h.Get("List-Id")), strings.ToLower(mf.List)) {
+			return false
+		}
+	}
+	return true
+}
+
+// MailSource is a parsed `maildir://`, `imap://` or `imaps://` source.
+type MailSource struct {
+	URL    *url.URL
+	Filter MailFilter
+}
+
+// ParseMailSource parses a mail source URI, the `from` and `list` query
+// parameters select the messages of the feed.
+func ParseMailSource(uri string) (*MailSource, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "maildir":
+		if !filepath.IsAbs(u.Path) {
+			return nil, fmt.Errorf("error: maildir path %q must be absolute", u.Path)
+		}
+	case "imap", "imaps":
+		if u.Host == "" {
+			return nil, fmt.Errorf("error: no imap server in %q", uri)
+		}
+	default:
+		return nil, fmt.Errorf("error: not a mail uri %q", uri)
+	}
+
+	return &MailSource{
+		URL: u,
+		Filter: MailFilter{
+			From: u.Query().Get("from"),
+			List: u.Query().Get("list"),
+		},
+	}, nil
+}
+
+// MailItem converts an email message into a feed item, the subject becomes
+// the title and the HTML body (or plain text body) the content.
+func MailItem(msg *mail.Message) (*gofeed.Item, error) {
+	dec := &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	published, err := msg.Header.Date()
+	if err != nil {
+		published = time.Now()
+	}
+
+	html, text, err := mailBody(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &gofeed.Item{
+		GUID:            strings.Trim(msg.Header.Get("Message-Id"), "<>"),
+		Title:           subject,
+		Description:     html,
+		Link:            strings.Trim(msg.Header.Get("Archived-At"), "<>"),
+		PublishedParsed: &published,
+	}
+	if html == "" {
+		item.Description = text
+		item.Custom = map[string]string{ItemFormat: ItemFormatMarkdown}
+	}
+
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		item.Author = &gofeed.Person{Name: from.Name, Email: from.Address}
+	}
+
+	return item, nil
+}
+
+// mailBody returns the HTML and plain text bodies of a (multipart) message.
+func mailBody(contentType, encoding string, body io.Reader) (string, string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var html, text string
+
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", "", fmt.Errorf("error reading message part: %w", err)
+			}
+
+			partHTML, partText, err := mailBody(
+				part.Header.Get("Content-Type"),
+				part.Header.Get("Content-Transfer-Encoding"),
+				part,
+			)
+			if err != nil {
+				return "", "", err
+			}
+			if html == "" {
+				html = partHTML
+			}
+			if text == "" {
+				text = partText
+			}
+		}
+
+		return html, text, nil
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	// Bodies in other charsets than UTF-8 (or ASCII) are decoded to UTF-8, or
+	// read as they are if the charset is unknown.
+	if label := strings.ToLower(params["charset"]); label != "" && label != "utf-8" && label != "us-ascii" {
+		if r, err := charset.NewReaderLabel(label, body); err == nil {
+			body = r
+		} else {
+			log.WithError(err).Warnf("error decoding message body in %s", label)
+		}
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, mailMaxMessageSize))
+	if err != nil {
+		return "", "", fmt.Errorf("error reading message body: %w", err)
+	}
+
+	switch mediaType {
+	case "text/html":
+		return string(data), "", nil
+	case "text/plain":
+		return "", string(data), nil
+	default:
+		return "", "", nil
+	}
+}
+
+// ReadMaildir returns the messages of the maildir `dir` not in `seen` keyed by
+// their unique maildir name, and the names of its messages seen before or
+// read now. Messages that fail to be read are not, so they are retried.
+// Messages are never moved or flagged.
+func ReadMaildir(dir string, seen map[string]bool) (map[string]*mail.Message, []string, error) {
+	msgs := make(map[string]*mail.Message)
+	var keys []string
+
+	for _, sub := range []string{"new", "cur"} {
+		files, err := ioutil.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading maildir %s: %w", dir, err)
+		}
+
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+
+			// The unique name is stable when a message moves from new/ to cur/
+			// and gains flags (`:2,S`).
+			key := strings.SplitN(file.Name(), ":", 2)[0]
+			if seen[key] {
+				keys = append(keys, key)
+				continue
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, sub, file.Name()))
+			if err != nil {
+				log.WithError(err).Warnf("error reading message %s", file.Name())
+				continue
+			}
+
+			msg, err := mail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				log.WithError(err).Warnf("error parsing message %s", file.Name())
+				continue
+			}
+
+			msgs[key] = msg
+			keys = append(keys, key)
+		}
+	}
+
+	return msgs, keys, nil
+}
+
+// IMAPClient is a minimal read-only IMAP4rev1 client, just enough to fetch
+// new messages from a mailbox.
+type IMAPClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// DialIMAP connects to the IMAP server of `u`, over TLS for `imaps://`.
+func DialIMAP(u *url.URL) (*IMAPClient, error) {
+	host := u.Host
+	if u.Port() == "" {
+		port := "143"
+		if u.Scheme == "imaps" {
+			port = "993"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	dialer := &net.Dialer{Timeout: imapTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if u.Scheme == "imaps" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(imapTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &IMAPClient{conn: conn, r: bufio.NewReader(conn)}
+
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("error: unexpected imap greeting %q", greeting)
+	}
+
+	return c, nil
+}
+
+func (c *IMAPClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("error reading imap response: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Command sends a command and returns its untagged responses, each with any
+// literals it contained, or an error if the command did not complete OK.
+func (c *IMAPClient) Command(format string, args ...interface{}) ([]string, [][]byte, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		lines    []string
+		literals [][]byte
+	)
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// A line ending in `{N}` is followed by a literal of N bytes and then
+		// the remainder of the response.
+		for strings.HasSuffix(line, "}") {
+			i := strings.LastIndex(line, "{")
+			if i == -1 {
+				break
+			}
+			n, err := strconv.Atoi(line[i+1 : len(line)-1])
+			if err != nil || n < 0 || n > mailMaxMessageSize {
+				break
+			}
+			literal := make([]byte, n)
+			if _, err := io.ReadFull(c.r, literal); err != nil {
+				return nil, nil, fmt.Errorf("error reading imap literal: %w", err)
+			}
+			literals = append(literals, literal)
+			rest, err := c.readLine()
+			if err != nil {
+				return nil, nil, err
+			}
+			line = line[:i] + rest
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, nil, fmt.Errorf("%w: %s", ErrIMAPCommandFailed, status)
+			}
+			return lines, literals, nil
+		}
+
+		lines = append(lines, line)
+	}
+}
+
+// Close logs out and closes the connection.
+func (c *IMAPClient) Close() error {
+	_, _, _ = c.Command("LOGOUT")
+	return c.conn.Close()
+}
+
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// imapResponseCode returns the number of the response code `code` (as in
+// `* OK [UIDVALIDITY 3857529045]`) of the untagged responses `lines`.
+func imapResponseCode(lines []string, code string) (uint32, bool) {
+	for _, line := range lines {
+		i := strings.Index(line, "["+code+" ")
+		if i == -1 {
+			continue
+		}
+		value := line[i+len(code)+2:]
+		if j := strings.Index(value, "]"); j != -1 {
+			value = value[:j]
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			continue
+		}
+		return uint32(n), true
+	}
+	return 0, false
+}
+
+// FetchIMAP returns the messages of the mailbox of the `imap://` source newer
+// than the highest UID of the `state` keyed by their UID, and updates the
+// `state` with the messages returned. The mailbox is opened read-only. If the
+// mailbox's UIDVALIDITY changed its UIDs were reassigned, so only the messages
+// arriving from then on are new.
+func FetchIMAP(src *MailSource, state *mailState) (map[string]*mail.Message, error) {
+	c, err := DialIMAP(src.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if user := src.URL.User; user != nil {
+		password, _ := user.Password()
+		if _, _, err := c.Command("LOGIN %s %s", imapQuote(user.Username()), imapQuote(password)); err != nil {
+			return nil, err
+		}
+	}
+
+	mailbox := strings.TrimPrefix(src.URL.Path, "/")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	lines, _, err := c.Command("EXAMINE %s", imapQuote(mailbox))
+	if err != nil {
+		return nil, err
+	}
+
+	validity, ok := imapResponseCode(lines, "UIDVALIDITY")
+	if !ok {
+		return nil, fmt.Errorf("error: no uidvalidity for imap mailbox %s", mailbox)
+	}
+	if state.UIDValidity != 0 && state.UIDValidity != validity {
+		log.Warnf("uidvalidity of imap mailbox %s changed, skipping its current messages", mailbox)
+		state.UID = 0
+		if next, ok := imapResponseCode(lines, "UIDNEXT"); ok && next > 0 {
+			state.UID = next - 1
+		}
+	}
+	state.UIDValidity = validity
+
+	criteria := fmt.Sprintf("UID %d:*", state.UID+1)
+	if src.Filter.From != "" {
+		criteria += " FROM " + imapQuote(src.Filter.From)
+	}
+	lines, _, err = c.Command("UID SEARCH %s", criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []uint32
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "* SEARCH") {
+			continue
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "* SEARCH")) {
+			uid, err := strconv.ParseUint(field, 10, 32)
+			// `n:*` always matches the highest UID, even if it is below n.
+			if err != nil || uint32(uid) <= state.UID {
+				continue
+			}
+			uids = append(uids, uint32(uid))
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+
+	msgs := make(map[string]*mail.Message)
+	for _, uid := range uids {
+		_, literals, err := c.Command("UID FETCH %d BODY.PEEK[]", uid)
+		if err != nil {
+			return nil, err
+		}
+		state.UID = uid
+		if len(literals) == 0 {
+			continue
+		}
+
+		msg, err := mail.ReadMessage(bytes.NewReader(literals[0]))
+		if err != nil {
+			log.WithError(err).Warnf("error parsing imap message %d", uid)
+			continue
+		}
+
+		msgs[fmt.Sprintf("imap:%d", uid)] = msg
+	}
+
+	return msgs, nil
+}
+
+// UpdateMailFeed appends the new messages of the mail source `uri` matching
+// its sender/list filter to the feed `name`.
+func UpdateMailFeed(conf *Config, name, uri string) error {
+	src, err := ParseMailSource(uri)
+	if err != nil {
+		return err
+	}
+
+	var state mailState
+	if err := LoadState(conf, name, "mail", &state); err != nil {
+		return err
+	}
+
+	var msgs map[string]*mail.Message
+	if src.URL.Scheme == "maildir" {
+		seen := make(map[string]bool)
+		for _, key := range state.Seen {
+			seen[key] = true
+		}
+
+		// Only the messages still in the maildir are remembered, the others
+		// cannot be seen again.
+		msgs, state.Seen, err = ReadMaildir(src.URL.Path, seen)
+		sort.Strings(state.Seen)
+	} else {
+		msgs, err = FetchIMAP(src, &state)
+	}
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(msgs))
+	for key := range msgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var items []*gofeed.Item
+	for _, key := range keys {
+		msg := msgs[key]
+
+		if !src.Filter.Match(msg.Header) {
+			continue
+		}
+
+		item, err := MailItem(msg)
+		if err != nil {
+			log.WithError(err).Warnf("error reading message %s for %s", key, name)
+			continue
+		}
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].PublishedParsed.Before(*items[j].PublishedParsed)
+	})
+
+	if err := WriteFeedItems(conf, name, items); err != nil {
+		return err
+	}
+
+	return SaveState(conf, name, "mail", state)
+}
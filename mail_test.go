@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNewsletter = "From: Weekly News <news@example.com>\r\n" +
+	"To: feeds@example.org\r\n" +
+	"Subject: =?utf-8?q?Issue_=2342_=E2=80=94_Hello?=\r\n" +
+	"Date: Sat, 02 Jan 2021 10:00:00 +0000\r\n" +
+	"Message-Id: <42@example.com>\r\n" +
+	"List-Id: Weekly News <weekly.example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Plain version\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<p>This week: <b>everything</b> =3D great</p>\r\n" +
+	"--b1--\r\n"
+
+const testOtherMail = "From: someone@else.example\r\n" +
+	"Subject: Not a newsletter\r\n" +
+	"Date: Sun, 03 Jan 2021 10:00:00 +0000\r\n" +
+	"\r\n" +
+	"Hi!\r\n"
+
+// testMailbox is the INBOX served by a stand-in IMAP server, its messages
+// keyed by UID.
+type testMailbox struct {
+	sync.Mutex
+	validity int
+	msgs     map[int]string
+}
+
+func (mbox *testMailbox) Add(uid int, msg string) {
+	mbox.Lock()
+	defer mbox.Unlock()
+	mbox.msgs[uid] = msg
+}
+
+// search returns the UIDs of the messages matching the `UID n:*` and `FROM`
+// criteria, the highest UID always matching `n:*` as with real servers.
+func (mbox *testMailbox) search(criteria []string) []string {
+	mbox.Lock()
+	defer mbox.Unlock()
+
+	from, max := 1, 0
+	for i := 0; i+1 < len(criteria); i += 2 {
+		switch strings.ToUpper(criteria[i]) {
+		case "UID":
+			from, _ = strconv.Atoi(strings.TrimSuffix(criteria[i+1], ":*"))
+		}
+	}
+	for uid := range mbox.msgs {
+		if uid > max {
+			max = uid
+		}
+	}
+
+	var uids []string
+	for uid, msg := range mbox.msgs {
+		if uid < from && uid != max {
+			continue
+		}
+		for i := 0; i+1 < len(criteria); i += 2 {
+			if strings.ToUpper(criteria[i]) == "FROM" && !strings.Contains(msg, strings.Trim(criteria[i+1], `"`)) {
+				msg = ""
+			}
+		}
+		if msg != "" {
+			uids = append(uids, strconv.Itoa(uid))
+		}
+	}
+	return uids
+}
+
+// newTestIMAPServer starts a stand-in IMAP server on a random local port that
+// serves the `mbox` as its single INBOX.
+func newTestIMAPServer(t *testing.T, mbox *testMailbox) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				fmt.Fprint(conn, "* OK test server ready\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					if len(fields) < 2 {
+						return
+					}
+					tag, cmd := fields[0], strings.ToUpper(fields[1])
+					switch {
+					case cmd == "LOGIN":
+						if fields[2] != `"alice"` || fields[3] != `"secret"` {
+							fmt.Fprintf(conn, "%s NO invalid credentials\r\n", tag)
+							continue
+						}
+					case cmd == "EXAMINE":
+						mbox.Lock()
+						fmt.Fprintf(conn, "* %d EXISTS\r\n", len(mbox.msgs))
+						fmt.Fprintf(conn, "* OK [UIDVALIDITY %d] UIDs valid\r\n", mbox.validity)
+						mbox.Unlock()
+					case cmd == "UID" && strings.ToUpper(fields[2]) == "SEARCH":
+						fmt.Fprintf(conn, "* SEARCH %s\r\n", strings.Join(mbox.search(fields[3:]), " "))
+					case cmd == "UID" && strings.ToUpper(fields[2]) == "FETCH":
+						uid, _ := strconv.Atoi(fields[3])
+						mbox.Lock()
+						msg := mbox.msgs[uid]
+						mbox.Unlock()
+						fmt.Fprintf(conn, "* 1 FETCH (UID %d BODY[] {%d}\r\n%s)\r\n", uid, len(msg), msg)
+					case cmd == "LOGOUT":
+						fmt.Fprintf(conn, "* BYE\r\n%s OK LOGOUT completed\r\n", tag)
+						return
+					}
+					fmt.Fprintf(conn, "%s OK %s completed\r\n", tag, cmd)
+				}
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestMailItem(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	msgs, keys, err := ReadMaildir(writeTestMaildir(t, testNewsletter), nil)
+	require.NoError(err)
+	require.Len(msgs, 1)
+	assert.Equal([]string{"1609581600.0.localhost"}, keys)
+
+	for _, msg := range msgs {
+		item, err := MailItem(msg)
+		require.NoError(err)
+		assert.Equal("Issue #42 — Hello", item.Title)
+		assert.Equal("42@example.com", item.GUID)
+		assert.Contains(item.Description, "<b>everything</b> = great")
+		assert.Equal("news@example.com", item.Author.Email)
+		assert.Equal(2021, item.PublishedParsed.Year())
+	}
+
+	// Messages that fail to parse are not seen, so they are retried.
+	_, keys, err = ReadMaildir(writeTestMaildir(t, testNewsletter, "not a header\n\nbody"), nil)
+	require.NoError(err)
+	assert.Equal([]string{"1609581600.0.localhost"}, keys)
+
+	// Bodies and headers in other charsets are decoded.
+	msg, err := mail.ReadMessage(strings.NewReader("Subject: =?iso-8859-1?q?Caf=E9?=\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\nUn caf=E9 cr=E8me\r\n"))
+	require.NoError(err)
+	item, err := MailItem(msg)
+	require.NoError(err)
+	assert.Equal("Café", item.Title)
+	assert.Equal("Un café crème\r\n", item.Description)
+}
+
+func writeTestMaildir(t *testing.T, msgs ...string) string {
+	dir := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, sub), 0755))
+	}
+	for i, msg := range msgs {
+		fn := filepath.Join(dir, "new", fmt.Sprintf("1609581600.%d.localhost", i))
+		require.NoError(t, os.WriteFile(fn, []byte(msg), 0644))
+	}
+	return dir
+}
+
+func TestUpdateMailFeed(t *testing.T) {
+	t.Run("maildir", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dir := writeTestMaildir(t, testNewsletter, testOtherMail)
+
+		conf := NewConfig()
+		conf.DataDir = t.TempDir()
+		uri := fmt.Sprintf("maildir://%s?list=weekly.example.com", dir)
+
+		require.NoError(UpdateMailFeed(conf, "weekly", uri))
+
+		// Messages moved to cur/ and flagged by a mail client are not new.
+		require.NoError(os.Rename(
+			filepath.Join(dir, "new", "1609581600.0.localhost"),
+			filepath.Join(dir, "cur", "1609581600.0.localhost:2,S"),
+		))
+		require.NoError(UpdateMailFeed(conf, "weekly", uri))
+
+		twts, err := ReadTwts(filepath.Join(conf.DataDir, "weekly.txt"))
+		require.NoError(err)
+		require.Len(twts, 1)
+		assert.True(strings.HasPrefix(twts[0].Text, "**Issue #42 — Hello**"))
+		assert.Contains(twts[0].Text, "This week: **everything** = great")
+
+		// Messages deleted from the maildir are forgotten.
+		require.NoError(os.Remove(filepath.Join(dir, "new", "1609581600.1.localhost")))
+		require.NoError(UpdateMailFeed(conf, "weekly", uri))
+
+		var state mailState
+		require.NoError(LoadState(conf, "weekly", "mail", &state))
+		assert.Equal([]string{"1609581600.0.localhost"}, state.Seen)
+	})
+
+	t.Run("imap", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		mbox := &testMailbox{
+			validity: 1,
+			msgs: map[int]string{
+				9:  testNewsletter,
+				10: testOtherMail,
+			},
+		}
+		addr := newTestIMAPServer(t, mbox)
+		uri := fmt.Sprintf("imap://alice:secret@%s/INBOX?from=news@example.com", addr)
+
+		conf := NewConfig()
+		conf.DataDir = t.TempDir()
+
+		require.NoError(UpdateMailFeed(conf, "weekly", uri))
+		require.NoError(UpdateMailFeed(conf, "weekly", uri))
+
+		twts, err := ReadTwts(filepath.Join(conf.DataDir, "weekly.txt"))
+		require.NoError(err)
+		require.Len(twts, 1)
+		assert.True(strings.HasPrefix(twts[0].Text, "**Issue #42 — Hello**"))
+
+		var state mailState
+		require.NoError(LoadState(conf, "weekly", "mail", &state))
+		assert.Equal(mailState{UIDValidity: 1, UID: 9}, state)
+
+		// Only messages with higher UIDs are new.
+		mbox.Add(11, strings.Replace(testNewsletter, "Issue_=2342", "Issue_=2343", 1))
+		require.NoError(UpdateMailFeed(conf, "weekly", uri))
+
+		twts, err = ReadTwts(filepath.Join(conf.DataDir, "weekly.txt"))
+		require.NoError(err)
+		require.Len(twts, 2)
+		assert.True(strings.HasPrefix(twts[1].Text, "**Issue #43 — Hello**"))
+
+		err = UpdateMailFeed(conf, "other", fmt.Sprintf("imap://alice:wrong@%s/INBOX", addr))
+		assert.ErrorIs(err, ErrIMAPCommandFailed)
+	})
+}
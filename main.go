@@ -18,6 +18,12 @@ var (
 	baseURL   string
 	dataDir   string
 	feedsFile string
+	webSub    bool
+	dryRun    bool
+
+	initialBackfill int
+	maxItems        int
+	backfill        int
 )
 
 func init() {
@@ -34,6 +40,11 @@ func init() {
 	flag.StringVarP(&dataDir, "data-dir", "d", "./data", "data directory to store feeds in")
 	flag.StringVarP(&baseURL, "base-url", "u", "http://0.0.0.0:8000", "base url for generated urls")
 	flag.StringVarP(&feedsFile, "feeds-file", "f", "feeds.yaml", "feeds configuration file in server mode")
+	flag.BoolVarP(&webSub, "websub", "w", false, "subscribe to feeds' WebSub hubs for push updates in server mode")
+	flag.BoolVarP(&dryRun, "dry-run", "n", false, "show which recent items of the named feed pass its filters")
+	flag.IntVarP(&initialBackfill, "initial-backfill", "i", DefaultBackfill, "number of items new feeds are backfilled with (0 for all)")
+	flag.IntVarP(&maxItems, "max-items", "m", DefaultMaxItems, "maximum number of items emitted per update of a feed (0 for no limit)")
+	flag.IntVarP(&backfill, "backfill", "B", 0, "backfill the named feed with up to this many items of its history (not while a server updates it)")
 }
 
 func flagNameFromEnvironmentName(s string) string {
@@ -72,13 +83,18 @@ func main() {
 		log.SetLevel(log.InfoLevel)
 	}
 
+	options := []Option{
+		WithBind(bind),
+		WithDataDir(dataDir),
+		WithBaseURL(baseURL),
+		WithFeedsFile(feedsFile),
+		WithWebSub(webSub),
+		WithBackfill(initialBackfill),
+		WithMaxItems(maxItems),
+	}
+
 	if server {
-		app, err := NewApp(
-			WithBind(bind),
-			WithDataDir(dataDir),
-			WithBaseURL(baseURL),
-			WithFeedsFile(feedsFile),
-		)
+		app, err := NewApp(options...)
 		if err != nil {
 			log.WithError(err).Fatal("error creating app for server mode")
 		}
@@ -88,22 +104,40 @@ func main() {
 		os.Exit(0)
 	}
 
+	if dryRun {
+		conf, err := NewConfigWithOptions(options...)
+		if err != nil {
+			log.WithError(err).Fatal("error creating config")
+		}
+		if err := conf.LoadFeeds(); err != nil {
+			log.WithError(err).Fatal("error loading feeds")
+		}
+		if err := DryRunFilters(conf, flag.Arg(0), os.Stdout); err != nil {
+			log.WithError(err).Fatal("error running filters")
+		}
+		os.Exit(0)
+	}
+
+	if backfill > 0 {
+		conf, err := NewConfigWithOptions(options...)
+		if err != nil {
+			log.WithError(err).Fatal("error creating config")
+		}
+		if err := conf.LoadFeeds(); err != nil {
+			log.WithError(err).Fatal("error loading feeds")
+		}
+		if err := BackfillFeed(conf, flag.Arg(0), backfill); err != nil {
+			log.WithError(err).Fatal("error backfilling feed")
+		}
+		os.Exit(0)
+	}
+
 	uri := flag.Arg(0)
 	name := flag.Arg(1)
 
 	conf := &Config{DataDir: "."}
 
-	u, err := ParseURI(uri)
-	if err != nil {
-		log.WithError(err).Errorf("error parsing feed %s: %s", name, uri)
-	} else {
-		switch u.Type {
-		case "rss", "http", "https":
-			if err := UpdateRSSFeed(conf, name, uri); err != nil {
-				log.WithError(err).Errorf("error updating rss feed %s: %s", name, uri)
-			}
-		default:
-			log.Warnf("error unknown feed type %s: %s", name, uri)
-		}
+	if err := UpdateFeed(conf, name, uri); err != nil {
+		log.WithError(err).Errorf("error updating feed %s: %s", name, uri)
 	}
 }
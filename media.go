@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	mediaResolution = 640 // px wide
+
+	// ItemMedia is the key of an item's `Custom` data holding the Markdown of
+	// its image or media enclosure.
+	ItemMedia = "media"
+)
+
+// Kinds of media an item can have.
+const (
+	MediaImage = "image"
+	MediaAudio = "audio"
+	MediaVideo = "video"
+)
+
+// Media is an image, podcast or video of an item.
+type Media struct {
+	Kind  string
+	URL   string
+	Title string
+}
+
+// Markdown returns the media as Markdown, an image is inlined and audio or
+// video is linked to.
+func (media *Media) Markdown() string {
+	switch media.Kind {
+	case MediaAudio:
+		return fmt.Sprintf("🎧 [%s](%s)", mediaTitle(media.Title, "Listen"), media.URL)
+	case MediaVideo:
+		return fmt.Sprintf("🎬 [%s](%s)", mediaTitle(media.Title, "Watch"), media.URL)
+	default:
+		return fmt.Sprintf("![%s](%s)", mediaTitle(media.Title, ""), media.URL)
+	}
+}
+
+func mediaTitle(title, fallback string) string {
+	title = strings.NewReplacer("[", "", "]", "", "\n", " ").Replace(strings.TrimSpace(title))
+	if title == "" {
+		return fallback
+	}
+	return title
+}
+
+func mediaKind(mimeType, medium string) string {
+	switch {
+	case medium == MediaImage || strings.HasPrefix(mimeType, "image/"):
+		return MediaImage
+	case medium == MediaAudio || strings.HasPrefix(mimeType, "audio/"):
+		return MediaAudio
+	case medium == MediaVideo || strings.HasPrefix(mimeType, "video/"):
+		return MediaVideo
+	default:
+		return ""
+	}
+}
+
+// ItemMediaOf returns the first image of the `item`, or if it has none its
+// first podcast or video enclosure, from its image, enclosures or Media RSS
+// `media:content` and `media:thumbnail` elements.
+func ItemMediaOf(item *gofeed.Item) *Media {
+	var candidates []*Media
+
+	if item.Image != nil && item.Image.URL != "" {
+		candidates = append(candidates, &Media{Kind: MediaImage, URL: item.Image.URL, Title: item.Image.Title})
+	}
+
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+		if kind := mediaKind(enclosure.Type, ""); kind != "" {
+			candidates = append(candidates, &Media{Kind: kind, URL: enclosure.URL})
+		}
+	}
+
+	if media, ok := item.Extensions["media"]; ok {
+		var elements []map[string]string
+		for _, group := range media["group"] {
+			for _, name := range []string{"content", "thumbnail"} {
+				for _, ext := range group.Children[name] {
+					elements = append(elements, mediaAttrs(ext.Attrs, name))
+				}
+			}
+		}
+		for _, name := range []string{"content", "thumbnail"} {
+			for _, ext := range media[name] {
+				elements = append(elements, mediaAttrs(ext.Attrs, name))
+			}
+		}
+
+		for _, attrs := range elements {
+			if attrs["url"] == "" {
+				continue
+			}
+			if kind := mediaKind(attrs["type"], attrs["medium"]); kind != "" {
+				candidates = append(candidates, &Media{Kind: kind, URL: attrs["url"]})
+			}
+		}
+	}
+
+	for _, media := range candidates {
+		if media.Kind == MediaImage {
+			return media
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+
+	return nil
+}
+
+func mediaAttrs(attrs map[string]string, name string) map[string]string {
+	if name == "thumbnail" && attrs["medium"] == "" {
+		// Thumbnails are always images
+		copied := map[string]string{"medium": MediaImage}
+		for k, v := range attrs {
+			copied[k] = v
+		}
+		return copied
+	}
+	return attrs
+}
+
+// MediaFile returns the path of the mirrored media `filename` of the feed
+// `name`.
+func MediaFile(conf *Config, name, filename string) string {
+	return filepath.Join(conf.DataDir, "media", name, filename)
+}
+
+// MirrorImage downloads and resizes the image `uri` for the feed `name`
+// unless it was mirrored before and returns its local URL.
+func MirrorImage(conf *Config, name, uri string) (string, error) {
+	filename := fmt.Sprintf("%s.png", FastHashString(uri))
+
+	if !Exists(MediaFile(conf, name, filename)) {
+		if err := os.MkdirAll(filepath.Dir(MediaFile(conf, name, filename)), 0755); err != nil {
+			return "", err
+		}
+
+		opts := &ImageOptions{
+			Resize:  true,
+			ResizeW: mediaResolution,
+		}
+
+		if err := DownloadImage(conf, uri, filepath.Join("media", name, filename), opts); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%s/%s/media/%s", strings.TrimSuffix(conf.BaseURL, "/"), name, filename), nil
+}
+
+// ResolveItemMedia sets the Markdown of the `item`'s media unless its content
+// already includes it, mirroring images if the feed `name` is configured to.
+func ResolveItemMedia(conf *Config, name string, item *gofeed.Item) {
+	media := ItemMediaOf(item)
+	if media == nil || strings.Contains(item.Description, media.URL) {
+		return
+	}
+
+	if feed := conf.Feeds[name]; feed != nil && feed.MirrorMedia && media.Kind == MediaImage {
+		uri, err := MirrorImage(conf, name, media.URL)
+		if err != nil {
+			log.WithError(err).Warnf("error mirroring image %s of %s", media.URL, name)
+		} else {
+			media.URL = uri
+		}
+	}
+
+	if item.Custom == nil {
+		item.Custom = make(map[string]string)
+	}
+	item.Custom[ItemMedia] = media.Markdown()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemMediaOf(t *testing.T) {
+	feed, err := gofeed.NewParser().ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/">
+  <channel>
+    <title>Example</title>
+    <item>
+      <title>Podcast</title>
+      <enclosure url="https://example.com/episode.mp3" type="audio/mpeg" length="1234"/>
+    </item>
+    <item>
+      <title>Podcast with cover</title>
+      <enclosure url="https://example.com/episode.mp3" type="audio/mpeg" length="1234"/>
+      <media:thumbnail url="https://example.com/cover.jpg"/>
+    </item>
+    <item>
+      <title>Video</title>
+      <media:group>
+        <media:content url="https://example.com/video.mp4" type="video/mp4"/>
+      </media:group>
+    </item>
+    <item>
+      <title>Nothing</title>
+    </item>
+  </channel>
+</rss>`)
+	require.NoError(t, err)
+	require.Len(t, feed.Items, 4)
+
+	assert.Equal(t, &Media{Kind: MediaAudio, URL: "https://example.com/episode.mp3"}, ItemMediaOf(feed.Items[0]))
+	assert.Equal(t, &Media{Kind: MediaImage, URL: "https://example.com/cover.jpg"}, ItemMediaOf(feed.Items[1]))
+	assert.Equal(t, &Media{Kind: MediaVideo, URL: "https://example.com/video.mp4"}, ItemMediaOf(feed.Items[2]))
+	assert.Nil(t, ItemMediaOf(feed.Items[3]))
+
+	assert.Equal(t, "🎧 [Listen](https://example.com/episode.mp3)", ItemMediaOf(feed.Items[0]).Markdown())
+	assert.Equal(t, "![](https://example.com/cover.jpg)", ItemMediaOf(feed.Items[1]).Markdown())
+}
+
+func TestMirrorMedia(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	require.NoError(png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1280, 720))))
+
+	requests := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(buf.Bytes())
+	}))
+	defer upstream.Close()
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["example"] = &Feed{Name: "example", MirrorMedia: true}
+
+	item := &gofeed.Item{
+		Title: "Hello",
+		Link:  "https://example.com/hello",
+		Image: &gofeed.Image{URL: upstream.URL + "/hello.png"},
+	}
+	ResolveItemMedia(conf, "example", item)
+	ResolveItemMedia(conf, "example", item)
+	assert.Equal(1, requests)
+
+	media := item.Custom[ItemMedia]
+	require.True(strings.HasPrefix(media, "![](https://feeds.example.com/example/media/"))
+
+	text, err := FormatItem(conf, "example", item)
+	require.NoError(err)
+	assert.Equal("**Hello**\u2028"+media+" ⌘ [Read more](https://example.com/hello)", text)
+
+	path := strings.TrimSuffix(strings.TrimPrefix(media, "![](https://feeds.example.com"), ")")
+
+	app := &App{conf: conf}
+	router := app.initRoutes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(http.StatusOK, w.Code)
+	assert.Equal("image/png", w.Header().Get("Content-Type"))
+
+	img, err := png.Decode(w.Body)
+	require.NoError(err)
+	assert.Equal(mediaResolution, img.Bounds().Dx())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/example/media/missing.png", nil))
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other/media/missing.png", nil))
+	assert.Equal(http.StatusNotFound, w.Code)
+}
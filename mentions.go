@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+var (
+	mastodonFeedURI = regexp.MustCompile(`^https?://([^/]+)/@([^/]+)\.rss$`)
+	markdownLink    = regexp.MustCompile(`(^|[^!])\[([^\]]*)\]\(([^)\s]+)\)`)
+	fediverseHandle = regexp.MustCompile(`(^|[^\w/<@])@([\w.]+@[\w-]+(?:\.[\w-]+)+)`)
+)
+
+// Mentions is a lookup of the identities of upstream sources, their URLs and
+// fediverse handles, to the feeds we aggregate them as.
+type Mentions struct {
+	conf *Config
+
+	// handles maps handles (user@server) to feed names
+	handles map[string]string
+
+	// prefixes are the URLs identifying feeds, and prefixing the URLs of their
+	// posts, to feed names, longest first
+	prefixes []mentionPrefix
+}
+
+type mentionPrefix struct {
+	prefix string
+	name   string
+}
+
+// identityKey normalizes a URL or handle for lookups.
+func identityKey(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "@")
+	if i := strings.Index(s, "://"); i != -1 {
+		s = s[i+len("://"):]
+	}
+	s = strings.TrimPrefix(s, "www.")
+	if i := strings.IndexAny(s, "?#"); i != -1 {
+		s = s[:i]
+	}
+	return strings.TrimSuffix(s, "/")
+}
+
+// NewMentions returns the lookup of the source identities of all the feeds
+// of `conf`, each feed is identified by its URI and any further identities
+// configured. Mastodon feeds are also identified by their handle and profile
+// and other feeds by the site (directory) their URI is on.
+func NewMentions(conf *Config) *Mentions {
+	mentions := &Mentions{
+		conf:    conf,
+		handles: make(map[string]string),
+	}
+
+	for name, feed := range conf.Feeds {
+		if feed == nil {
+			continue
+		}
+
+		identities := append([]string{}, feed.Identities...)
+
+		if match := mastodonFeedURI.FindStringSubmatch(feed.URI); match != nil {
+			identities = append(identities,
+				fmt.Sprintf("%s@%s", match[2], match[1]),
+				fmt.Sprintf("https://%s/@%s", match[1], match[2]),
+			)
+		} else if u, err := url.Parse(feed.URI); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+			identities = append(identities, u.Host+path.Dir(u.Path))
+		}
+
+		for _, identity := range identities {
+			key := identityKey(identity)
+			if key == "" {
+				continue
+			}
+			if !strings.Contains(key, "/") && strings.Contains(key, "@") {
+				mentions.handles[key] = name
+			} else {
+				mentions.prefixes = append(mentions.prefixes, mentionPrefix{prefix: key, name: name})
+			}
+		}
+	}
+
+	sort.SliceStable(mentions.prefixes, func(i, j int) bool {
+		if len(mentions.prefixes[i].prefix) != len(mentions.prefixes[j].prefix) {
+			return len(mentions.prefixes[i].prefix) > len(mentions.prefixes[j].prefix)
+		}
+		return mentions.prefixes[i].name < mentions.prefixes[j].name
+	})
+
+	return mentions
+}
+
+// Lookup returns the name of the feed identified by the URL or handle `s`, or
+// of the feed a URL `s` is a post of.
+func (mentions *Mentions) Lookup(s string) (string, bool) {
+	name, _, ok := mentions.lookup(s)
+	return name, ok
+}
+
+// lookup is Lookup also returning whether `s` identifies the feed exactly,
+// rather than being a URL under one of its identities.
+func (mentions *Mentions) lookup(s string) (string, bool, bool) {
+	key := identityKey(s)
+	if key == "" {
+		return "", false, false
+	}
+
+	if name, ok := mentions.handles[key]; ok {
+		return name, true, true
+	}
+
+	for _, p := range mentions.prefixes {
+		if key == p.prefix {
+			return p.name, true, true
+		}
+	}
+	for _, p := range mentions.prefixes {
+		if strings.HasPrefix(key, p.prefix+"/") {
+			return p.name, false, true
+		}
+	}
+
+	return "", false, false
+}
+
+// Mention returns the twtxt mention of the feed `name`.
+func (mentions *Mentions) Mention(name string) string {
+	return fmt.Sprintf("@<%s %s>", name, URLForFeed(mentions.conf, name))
+}
+
+// Expand replaces links to and handles of sources we aggregate in the
+// Markdown `text` of the feed `self` with mentions of their feeds. Links to
+// posts of those sources are kept and followed by the mention.
+func (mentions *Mentions) Expand(self, text string) string {
+	text = markdownLink.ReplaceAllStringFunc(text, func(s string) string {
+		match := markdownLink.FindStringSubmatch(s)
+		name, exact, ok := mentions.lookup(match[3])
+		if !ok || name == self {
+			return s
+		}
+		if exact {
+			return match[1] + mentions.Mention(name)
+		}
+		return s + " " + mentions.Mention(name)
+	})
+
+	return fediverseHandle.ReplaceAllStringFunc(text, func(s string) string {
+		match := fediverseHandle.FindStringSubmatch(s)
+		if name, ok := mentions.handles[identityKey(match[2])]; ok && name != self {
+			return match[1] + mentions.Mention(name)
+		}
+		return s
+	})
+}
+
+// Author returns the mention of the feed of the `item`'s author, if we
+// aggregate them, other than the feed `self`.
+func (mentions *Mentions) Author(self string, item *gofeed.Item) string {
+	authors := append([]*gofeed.Person{item.Author}, item.Authors...)
+	for _, author := range authors {
+		if author == nil {
+			continue
+		}
+		for _, identity := range []string{author.Email, author.Name} {
+			if name, ok := mentions.handles[identityKey(identity)]; ok && name != self {
+				return mentions.Mention(name)
+			}
+		}
+	}
+	return ""
+}
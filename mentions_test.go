@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMentions(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := NewConfig()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["alice@mastodon.social"] = &Feed{Name: "alice@mastodon.social", URI: "https://mastodon.social/@alice.rss"}
+	conf.Feeds["blog"] = &Feed{Name: "blog", URI: "https://www.example.com/blog/index.xml"}
+	conf.Feeds["news"] = &Feed{Name: "news", URI: "https://news.example.org/feed.xml", Identities: []string{"editor@news.example.org", "https://twitter.com/examplenews"}}
+
+	mentions := NewMentions(conf)
+
+	for identity, expected := range map[string]string{
+		"@alice@mastodon.social":              "alice@mastodon.social",
+		"Alice@Mastodon.Social":               "alice@mastodon.social",
+		"https://mastodon.social/@alice":      "alice@mastodon.social",
+		"https://mastodon.social/@alice/1234": "alice@mastodon.social",
+		"https://example.com/blog/2021/hello": "blog",
+		"http://www.example.com/blog/":        "blog",
+		"https://news.example.org/":           "news",
+		"editor@news.example.org":             "news",
+		"https://twitter.com/examplenews":     "news",
+	} {
+		name, ok := mentions.Lookup(identity)
+		assert.True(ok, identity)
+		assert.Equal(expected, name, identity)
+	}
+
+	for _, identity := range []string{
+		"https://mastodon.social/@bob",
+		"https://example.com/blogroll",
+		"https://twitter.com/examplenewsroom",
+		"bob@mastodon.social",
+		"",
+	} {
+		_, ok := mentions.Lookup(identity)
+		assert.False(ok, identity)
+	}
+
+	assert.Equal(
+		"Great post by [Bob](https://example.com/blog/2021/hello) @<blog https://feeds.example.com/blog/twtxt.txt> on @<blog https://feeds.example.com/blog/twtxt.txt> via @<alice@mastodon.social https://feeds.example.com/alice@mastodon.social/twtxt.txt>, not [me](https://news.example.org/about) or @bob@mastodon.social ![img](https://example.com/blog/a.png)",
+		mentions.Expand("news", "Great post by [Bob](https://example.com/blog/2021/hello) on [the blog](https://example.com/blog/) via @alice@mastodon.social, not [me](https://news.example.org/about) or @bob@mastodon.social ![img](https://example.com/blog/a.png)"),
+	)
+
+	item := &gofeed.Item{Author: &gofeed.Person{Name: "The Editor", Email: "editor@news.example.org"}}
+	assert.Equal("@<news https://feeds.example.com/news/twtxt.txt>", mentions.Author("blog", item))
+	assert.Equal("", mentions.Author("news", item))
+}
+
+func TestFormatItemMentions(t *testing.T) {
+	conf := NewConfig()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["alice@mastodon.social"] = &Feed{Name: "alice@mastodon.social", URI: "https://mastodon.social/@alice.rss"}
+	conf.Feeds["planet"] = &Feed{Name: "planet", URI: "https://planet.example.com/atom.xml"}
+
+	item := &gofeed.Item{
+		Title:       "Hello",
+		Description: `<p>Thanks <a href="https://mastodon.social/@alice">Alice</a></p>`,
+		Link:        "https://planet.example.com/hello",
+		Author:      &gofeed.Person{Name: "@alice@mastodon.social"},
+	}
+
+	text, err := FormatItem(conf, "planet", item)
+	require.NoError(t, err)
+	assert.Equal(t, "**Hello**\u2028Thanks @<alice@mastodon.social https://feeds.example.com/alice@mastodon.social/twtxt.txt> by @<alice@mastodon.social https://feeds.example.com/alice@mastodon.social/twtxt.txt> ⌘ [Read more](https://planet.example.com/hello)", text)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// refreshIntervals are the poll intervals (in seconds) hinted to clients
+// by a feed's `refresh` metadata.
+var refreshIntervals = []int{
+	15 * 60, 30 * 60, 60 * 60, 2 * 60 * 60, 4 * 60 * 60, 6 * 60 * 60, 12 * 60 * 60, 24 * 60 * 60,
+}
+
+// RefreshInterval returns the interval (in seconds) clients should poll a
+// feed whose entries were published at `times` at, half of the median gap
+// between entries rounded down to one of the `refreshIntervals`, or 0 if
+// there are too few entries to tell.
+func RefreshInterval(times []time.Time) int {
+	if len(times) < 2 {
+		return 0
+	}
+
+	sorted := append([]time.Time{}, times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	var gaps []time.Duration
+	for i := 1; i < len(sorted); i++ {
+		gaps = append(gaps, sorted[i].Sub(sorted[i-1]))
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+
+	seconds := int(gaps[len(gaps)/2].Seconds()) / 2
+
+	interval := refreshIntervals[0]
+	for _, i := range refreshIntervals {
+		if i <= seconds {
+			interval = i
+		}
+	}
+	return interval
+}
+
+// itemTimes returns the publication times of the `items`.
+func itemTimes(items []*gofeed.Item) []time.Time {
+	var times []time.Time
+	for _, item := range items {
+		if item.PublishedParsed != nil {
+			times = append(times, *item.PublishedParsed)
+		}
+	}
+	return times
+}
+
+// twtTimes returns the creation times of the `twts`.
+func twtTimes(twts []Twt) []time.Time {
+	var times []time.Time
+	for _, twt := range twts {
+		times = append(times, twt.Created)
+	}
+	return times
+}
+
+// normalizeLang normalizes a language tag such as `en-US` or `en_us`.
+func normalizeLang(lang string) string {
+	lang = strings.ReplaceAll(strings.TrimSpace(lang), "_", "-")
+	if i := strings.Index(lang, "-"); i != -1 {
+		return strings.ToLower(lang[:i]) + "-" + strings.ToUpper(lang[i+1:])
+	}
+	return strings.ToLower(lang)
+}
+
+// SetMeta sets the preamble metadata of the feed captured from its upstream
+// source, its homepage `link`, language `lang` and `refresh` interval, and
+// returns true if any changed. Empty (zero) values are left unchanged.
+func (feed *Feed) SetMeta(link, lang string, refresh int) bool {
+	changed := false
+
+	if link != "" && link != feed.Link {
+		feed.Link, changed = link, true
+	}
+	if lang = normalizeLang(lang); lang != "" && lang != feed.Lang {
+		feed.Lang, changed = lang, true
+	}
+	if refresh > 0 && refresh != feed.Refresh {
+		feed.Refresh, changed = refresh, true
+	}
+
+	return changed
+}
+
+// SetFollows sets the feeds the feed follows (as `nick url`) and returns true
+// if they changed.
+func (feed *Feed) SetFollows(follows []string) bool {
+	if strings.Join(follows, "\n") == strings.Join(feed.Follow, "\n") {
+		return false
+	}
+	feed.Follow = follows
+	return true
+}
+
+// feedMeta is the preamble metadata of a feed captured from its upstream
+// source, persisted as the feed's `meta` state rather than in the feeds file
+// as it is updated by background jobs.
+type feedMeta struct {
+	Link    string   `json:"link,omitempty"`
+	Lang    string   `json:"lang,omitempty"`
+	Refresh int      `json:"refresh,omitempty"`
+	Follow  []string `json:"follow,omitempty"`
+}
+
+// loadFeedMeta sets the preamble metadata of the `feed` named `name` captured
+// from its upstream source before, if any.
+func loadFeedMeta(conf *Config, name string, feed *Feed) error {
+	var meta feedMeta
+	if err := LoadState(conf, name, "meta", &meta); err != nil {
+		return err
+	}
+
+	feed.SetMeta(meta.Link, meta.Lang, meta.Refresh)
+	if len(meta.Follow) > 0 {
+		feed.SetFollows(meta.Follow)
+	}
+
+	return nil
+}
+
+// saveFeedMeta saves the preamble metadata of the `feed` named `name`.
+func saveFeedMeta(conf *Config, name string, feed *Feed) {
+	meta := feedMeta{Link: feed.Link, Lang: feed.Lang, Refresh: feed.Refresh, Follow: feed.Follow}
+	if err := SaveState(conf, name, "meta", meta); err != nil {
+		log.WithError(err).Warnf("error saving metadata of %s", name)
+	}
+}
+
+// updateFeedMeta updates the preamble metadata of the feed `name` captured
+// from its upstream source and saves it if it changed.
+func updateFeedMeta(conf *Config, name, link, lang string, refresh int) {
+	feed := conf.Feeds[name]
+	if feed == nil || !feed.SetMeta(link, lang, refresh) {
+		return
+	}
+
+	saveFeedMeta(conf, name, feed)
+}
+
+// parseRefresh parses the `refresh` metadata of a twtxt feed.
+func parseRefresh(s string) int {
+	refresh, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || refresh < 0 {
+		return 0
+	}
+	return refresh
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshInterval(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	every := func(d time.Duration, n int) []time.Time {
+		var times []time.Time
+		for i := 0; i < n; i++ {
+			times = append(times, start.Add(time.Duration(i)*d))
+		}
+		return times
+	}
+
+	assert.Equal(t, 0, RefreshInterval(nil))
+	assert.Equal(t, 0, RefreshInterval(every(time.Hour, 1)))
+	assert.Equal(t, 15*60, RefreshInterval(every(time.Minute, 10)))
+	assert.Equal(t, 30*60, RefreshInterval(every(time.Hour, 10)))
+	assert.Equal(t, 12*60*60, RefreshInterval(every(24*time.Hour, 10)))
+	assert.Equal(t, 24*60*60, RefreshInterval(every(7*24*time.Hour, 10)))
+}
+
+func TestSetMeta(t *testing.T) {
+	feed := &Feed{}
+
+	assert.True(t, feed.SetMeta("https://example.com/", "en_us", 3600))
+	assert.Equal(t, "https://example.com/", feed.Link)
+	assert.Equal(t, "en-US", feed.Lang)
+	assert.Equal(t, 3600, feed.Refresh)
+
+	assert.False(t, feed.SetMeta("https://example.com/", "en-US", 3600))
+	assert.False(t, feed.SetMeta("", "", 0))
+
+	assert.True(t, feed.SetFollows([]string{"alice https://example.com/alice.txt"}))
+	assert.False(t, feed.SetFollows([]string{"alice https://example.com/alice.txt"}))
+}
+
+func TestRenderPreambleMeta(t *testing.T) {
+	conf := NewConfig()
+	conf.BaseURL = "https://feeds.example.com"
+
+	feed := &Feed{
+		Name:    "example",
+		Type:    FeedTypeTwtxt,
+		Link:    "https://example.com/",
+		Lang:    "en",
+		Refresh: 3600,
+		Follow:  []string{"alice https://example.com/alice.txt", "bob https://example.com/bob.txt"},
+	}
+
+	preamble, err := RenderPreamble(conf, feed, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Contains(t, preamble, "# link        = Homepage https://example.com/\n")
+	assert.Contains(t, preamble, "# lang        = en\n")
+	assert.Contains(t, preamble, "# refresh     = 3600\n")
+	assert.Contains(t, preamble, "# follow      = alice https://example.com/alice.txt\n# follow      = bob https://example.com/bob.txt\n")
+
+	preamble, err = RenderPreamble(conf, &Feed{Name: "plain"}, time.Now())
+	require.NoError(t, err)
+	assert.NotContains(t, preamble, "# link")
+	assert.NotContains(t, preamble, "# lang")
+	assert.NotContains(t, preamble, "# refresh")
+	assert.NotContains(t, preamble, "# follow")
+}
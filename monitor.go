@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterBot("monitor", NewMonitorBot, false)
+}
+
+const (
+	// monitorSchedule is the default schedule of monitor bots
+	monitorSchedule = "@every 1m"
+
+	// monitorTimeout is the default timeout of a check
+	monitorTimeout = 10 * time.Second
+)
+
+// MonitorCheck is a check of a monitor bot, of an HTTP(S) endpoint which is
+// up if it responds with the expected status (any 2xx by default) or of a
+// TCP port (`tcp://host:port`) which is up if it accepts connections.
+type MonitorCheck struct {
+	Name    string `yaml:"name,omitempty"`
+	URL     string `yaml:"url"`
+	Status  int    `yaml:"status,omitempty"`
+	Timeout string `yaml:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+// checkState is what is remembered about a check, whether it is up, since
+// when and how it last responded.
+type checkState struct {
+	Up     bool      `json:"up"`
+	Since  time.Time `json:"since"`
+	Status string    `json:"status"`
+}
+
+// MonitorBot checks its feed's HTTP endpoints and TCP ports and twts when
+// one of them goes down or comes back up. The states of the checks are only
+// saved once the twts of a run are written.
+type MonitorBot struct {
+	conf     *Config
+	name     string
+	schedule string
+	checks   []MonitorCheck
+
+	mu     sync.Mutex
+	states map[string]*checkState // the states of the last run to commit
+}
+
+func NewMonitorBot(conf *Config, name string, feed *Feed) (Bot, error) {
+	if feed.Bot == nil || len(feed.Bot.Checks) == 0 {
+		return nil, fmt.Errorf("error: monitor bot %s has no checks", name)
+	}
+
+	bot := &MonitorBot{conf: conf, name: name, schedule: feed.Schedule}
+	if bot.schedule == "" {
+		bot.schedule = monitorSchedule
+	}
+
+	seen := make(map[string]bool)
+	for _, check := range feed.Bot.Checks {
+		u, err := url.Parse(check.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing url of check %q: %w", check.URL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "tcp" {
+			return nil, fmt.Errorf("error: unsupported check %q", check.URL)
+		}
+
+		if check.Name == "" {
+			check.Name = check.URL
+		}
+		if seen[check.Name] {
+			return nil, fmt.Errorf("error: duplicate check %q", check.Name)
+		}
+		seen[check.Name] = true
+
+		check.timeout = monitorTimeout
+		if check.Timeout != "" {
+			if check.timeout, err = time.ParseDuration(check.Timeout); err != nil {
+				return nil, fmt.Errorf("error parsing timeout of check %q: %w", check.Name, err)
+			}
+		}
+
+		bot.checks = append(bot.checks, check)
+	}
+
+	return bot, nil
+}
+
+func (bot *MonitorBot) Name() string { return bot.name }
+
+func (bot *MonitorBot) Description() string {
+	return fmt.Sprintf("I am @%s an automated feed that twts when the services I monitor go down or come back up", bot.name)
+}
+
+func (bot *MonitorBot) Schedule() string { return bot.schedule }
+
+func (bot *MonitorBot) Generate(ctx context.Context, now time.Time) ([]Twt, error) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	states := make(map[string]*checkState)
+	if err := LoadState(bot.conf, bot.name, "monitor", &states); err != nil {
+		return nil, err
+	}
+
+	results := make([]checkState, len(bot.checks))
+	var wg sync.WaitGroup
+	for i, check := range bot.checks {
+		wg.Add(1)
+		go func(i int, check MonitorCheck) {
+			defer wg.Done()
+			up, status := check.Run(ctx)
+			results[i] = checkState{Up: up, Since: now, Status: status}
+		}(i, check)
+	}
+	wg.Wait()
+
+	var twts []Twt
+	for i, check := range bot.checks {
+		result := results[i]
+
+		state, ok := states[check.Name]
+		switch {
+		case !ok:
+			// The first time a check is run it is only twted if it is down.
+			if !result.Up {
+				twts = append(twts, Twt{Created: now, Text: fmt.Sprintf("🔴 %s is down (%s)", check.Name, result.Status)})
+			}
+		case state.Up && !result.Up:
+			twts = append(twts, Twt{Created: now, Text: fmt.Sprintf(
+				"🔴 %s is down (%s) after being up for %s", check.Name, result.Status, formatUptime(now.Sub(state.Since)),
+			)})
+		case !state.Up && result.Up:
+			twts = append(twts, Twt{Created: now, Text: fmt.Sprintf(
+				"🟢 %s is up again (%s) after being down for %s", check.Name, result.Status, formatUptime(now.Sub(state.Since)),
+			)})
+		default:
+			state.Status = result.Status
+			continue
+		}
+
+		states[check.Name] = &result
+	}
+
+	// Forget checks no longer configured.
+	for name := range states {
+		if !bot.hasCheck(name) {
+			delete(states, name)
+		}
+	}
+
+	bot.states = states
+
+	return twts, nil
+}
+
+// Commit saves the states of the checks of the bot's last run.
+func (bot *MonitorBot) Commit() error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	if bot.states == nil {
+		return nil
+	}
+	return SaveState(bot.conf, bot.name, "monitor", bot.states)
+}
+
+func (bot *MonitorBot) hasCheck(name string) bool {
+	for _, check := range bot.checks {
+		if check.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the check and returns whether it is up and how it responded, its
+// HTTP status or the error it failed with.
+func (check MonitorCheck) Run(ctx context.Context) (bool, string) {
+	ctx, cancel := context.WithTimeout(ctx, check.timeout)
+	defer cancel()
+
+	u, err := url.Parse(check.URL)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	if u.Scheme == "tcp" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return false, err.Error()
+		}
+		conn.Close()
+		return true, "connected"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.URL, nil)
+	if err != nil {
+		return false, err.Error()
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("feeds/%s", FullVersion()))
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return false, err.Error()
+	}
+	res.Body.Close()
+
+	if check.Status != 0 {
+		return res.StatusCode == check.Status, res.Status
+	}
+	return res.StatusCode/100 == 2, res.Status
+}
+
+// formatUptime formats the duration `d` a check was up or down for, to the
+// second if it is under a minute and otherwise to the minute (as `1h5m`).
+func formatUptime(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+
+	s := strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
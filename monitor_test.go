@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorBot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	addr := listener.Addr().String()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.Feeds["status"] = &Feed{
+		Name: "status",
+		Type: FeedTypeBot,
+		Bot: &FeedBot{
+			Kind: "monitor",
+			Checks: []MonitorCheck{
+				{Name: "web", URL: server.URL},
+				{Name: "db", URL: "tcp://" + addr, Timeout: "1s"},
+			},
+		},
+	}
+
+	bots, err := NewBots(conf)
+	require.NoError(err)
+	bot := bots["status"]
+	require.NotNil(bot)
+	assert.Equal(monitorSchedule, BotSchedule(conf, bot))
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := func(now time.Time) {
+		require.NoError(RunBot(conf, bot, now))
+	}
+	texts := func() []string {
+		twts, err := ReadTwts(filepath.Join(conf.DataDir, "status.txt"))
+		require.NoError(err)
+		var texts []string
+		for _, twt := range twts {
+			texts = append(texts, twt.Text)
+		}
+		return texts
+	}
+
+	// Nothing is twted while everything is up.
+	run(start)
+	run(start.Add(time.Minute))
+	assert.Empty(texts())
+
+	status = http.StatusServiceUnavailable
+
+	// A transition whose twt was not written is twted again.
+	twts, err := bot.Generate(context.Background(), start.Add(90*time.Minute))
+	require.NoError(err)
+	require.Len(twts, 1)
+
+	run(start.Add(90 * time.Minute))
+	run(start.Add(91 * time.Minute))
+	require.Len(texts(), 1)
+	assert.Equal("🔴 web is down (503 Service Unavailable) after being up for 1h30m", texts()[0])
+
+	status = http.StatusOK
+	listener.Close()
+	run(start.Add(95 * time.Minute))
+	require.Len(texts(), 3)
+	assert.Equal("🟢 web is up again (200 OK) after being down for 5m", texts()[1])
+	assert.True(strings.HasPrefix(texts()[2], "🔴 db is down ("), texts()[2])
+}
+
+func TestMonitorBotErrors(t *testing.T) {
+	conf := NewConfig()
+
+	for _, checks := range [][]MonitorCheck{
+		nil,
+		{{URL: "ftp://example.com"}},
+		{{URL: "https://example.com"}, {URL: "https://example.com"}},
+		{{URL: "https://example.com", Timeout: "soon"}},
+	} {
+		_, err := NewMonitorBot(conf, "status", &Feed{Bot: &FeedBot{Checks: checks}})
+		assert.Error(t, err)
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	assert.Equal(t, "42s", formatUptime(42*time.Second))
+	assert.Equal(t, "5m", formatUptime(5*time.Minute+10*time.Second))
+	assert.Equal(t, "2h", formatUptime(2*time.Hour))
+	assert.Equal(t, "26h3m", formatUptime(26*time.Hour+3*time.Minute))
+}
@@ -23,6 +23,15 @@ const (
 
 	// DefaultMaxFeedSize is the default maximum feed size before rotation
 	DefaultMaxFeedSize = 1 << 19 // ~512KB
+
+	// DefaultWebSub is the default for subscribing to feeds' WebSub hubs
+	DefaultWebSub = false
+
+	// DefaultBackfill is the default number of items new feeds are backfilled with
+	DefaultBackfill = maxTweets
+
+	// DefaultMaxItems is the default maximum number of items emitted per update
+	DefaultMaxItems = 50
 )
 
 func NewConfig() *Config {
@@ -34,6 +43,9 @@ func NewConfig() *Config {
 		BaseURL:     DefaultBaseURL,
 		FeedsFile:   DefaultFeedsFile,
 		MaxFeedSize: DefaultMaxFeedSize,
+		WebSub:      DefaultWebSub,
+		Backfill:    DefaultBackfill,
+		MaxItems:    DefaultMaxItems,
 
 		Feeds: make(map[string]*Feed),
 	}
@@ -42,6 +54,19 @@ func NewConfig() *Config {
 // Option is a function that takes a config struct and modifies it
 type Option func(*Config) error
 
+// NewConfigWithOptions returns a new config with the `options` applied.
+func NewConfigWithOptions(options ...Option) (*Config, error) {
+	conf := NewConfig()
+
+	for _, opt := range options {
+		if err := opt(conf); err != nil {
+			return nil, err
+		}
+	}
+
+	return conf, nil
+}
+
 // WithDebug sets the debug mode lfag
 func WithDebug(debug bool) Option {
 	return func(cfg *Config) error {
@@ -84,3 +109,28 @@ func WithBaseURL(baseURL string) Option {
 		return nil
 	}
 }
+
+// WithWebSub enables subscribing to feeds' WebSub hubs, this requires the
+// Base URL to be reachable by the hubs
+func WithWebSub(webSub bool) Option {
+	return func(cfg *Config) error {
+		cfg.WebSub = webSub
+		return nil
+	}
+}
+
+// WithBackfill sets the number of items new feeds are backfilled with
+func WithBackfill(backfill int) Option {
+	return func(cfg *Config) error {
+		cfg.Backfill = backfill
+		return nil
+	}
+}
+
+// WithMaxItems sets the maximum number of items emitted per update of a feed
+func WithMaxItems(maxItems int) Option {
+	return func(cfg *Config) error {
+		cfg.MaxItems = maxItems
+		return nil
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxArticleSize is the largest article page we read
+	maxArticleSize = 1 << 22 // 4MB
+
+	// minArticleLength is the least length of text extracted as an article
+	minArticleLength = 140
+
+	// minParagraphLength is the least length of text of a paragraph scored
+	minParagraphLength = 25
+)
+
+// ErrNoArticle is returned when no article could be extracted from a page.
+var ErrNoArticle = errors.New("error: no article found")
+
+// clutterSelector selects elements that are never part of an article.
+const clutterSelector = `script, style, noscript, nav, header, footer, aside, form,
+button, iframe, object, embed, svg, link, meta`
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|sponsor|advert|\bad-|popup|share|social|related|menu|banner|cookie|subscribe|newsletter|breadcrumb`)
+	likelyCandidates   = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text`)
+)
+
+// ExtractArticle extracts the main content of the HTML page `r` with
+// readability-style heuristics and returns it as HTML. Paragraphs are
+// scored by their length and number of commas and their scores are added
+// up by the elements containing them, the element with the highest score,
+// after accounting for its class, id and density of links, is the article.
+func ExtractArticle(r io.Reader) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(r, maxArticleSize))
+	if err != nil {
+		return "", err
+	}
+
+	doc.Find(clutterSelector).Remove()
+	doc.Find("body *").Each(func(_ int, s *goquery.Selection) {
+		match := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikelyCandidates.MatchString(match) && !likelyCandidates.MatchString(match) {
+			s.Remove()
+		}
+	})
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*goquery.Selection
+	addScore := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 || goquery.NodeName(s) == "body" || goquery.NodeName(s) == "html" {
+			return
+		}
+		node := s.Get(0)
+		if _, ok := scores[node]; !ok {
+			scores[node] = classWeight(s)
+			candidates = append(candidates, s)
+		}
+		scores[node] += score
+	}
+
+	doc.Find("p, pre, td").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if len(text) < minParagraphLength {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ","))
+		if n := float64(len(text)) / 100; n < 3 {
+			score += n
+		} else {
+			score += 3
+		}
+
+		addScore(s.Parent(), score)
+		addScore(s.Parent().Parent(), score/2)
+	})
+
+	var (
+		best      *goquery.Selection
+		bestScore float64
+	)
+	for _, candidate := range candidates {
+		score := scores[candidate.Get(0)] * (1 - linkDensity(candidate))
+		if best == nil || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+
+	if best == nil {
+		best = doc.Find("article, main").First()
+	}
+	if best.Length() == 0 || len(strings.TrimSpace(best.Text())) < minArticleLength {
+		return "", ErrNoArticle
+	}
+
+	return best.Html()
+}
+
+// classWeight scores an element by its class and id looking like content.
+func classWeight(s *goquery.Selection) float64 {
+	weight := 0.0
+	for _, attr := range []string{"class", "id"} {
+		value := s.AttrOr(attr, "")
+		if value == "" {
+			continue
+		}
+		if likelyCandidates.MatchString(value) {
+			weight += 25
+		}
+		if unlikelyCandidates.MatchString(value) {
+			weight -= 25
+		}
+	}
+	if goquery.NodeName(s) == "article" {
+		weight += 25
+	}
+	return weight
+}
+
+// linkDensity returns the share of the text of an element that is linked.
+func linkDensity(s *goquery.Selection) float64 {
+	length := len(s.Text())
+	if length == 0 {
+		return 0
+	}
+
+	links := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		links += len(a.Text())
+	})
+
+	return float64(links) / float64(length)
+}
+
+// ArticleFile returns the path of the cached article `link` of the feed
+// `name`.
+func ArticleFile(conf *Config, name, link string) string {
+	return filepath.Join(conf.DataDir, "articles", name, fmt.Sprintf("%s.html", FastHashString(link)))
+}
+
+// FetchArticle fetches the page `link` of an item of the feed `name` and
+// extracts its article, unless it was fetched before. Pages without an
+// article are cached as such too so each page is only ever fetched once.
+func FetchArticle(conf *Config, name, link string) (string, error) {
+	fn := ArticleFile(conf, name, link)
+
+	if data, err := os.ReadFile(fn); err == nil {
+		if len(data) == 0 {
+			return "", ErrNoArticle
+		}
+		return string(data), nil
+	}
+
+	res, err := HTTPGet(link)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	article, err := ExtractArticle(res.Body)
+	if err != nil && !errors.Is(err, ErrNoArticle) {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(fn, []byte(article), 0644); err != nil {
+		return "", err
+	}
+
+	if article == "" {
+		return "", ErrNoArticle
+	}
+	return article, nil
+}
+
+// ResolveItemArticle replaces the content of the `item` with the article
+// its link points to if the feed `name` is in readability mode and the
+// article is longer than what the feed ships.
+func ResolveItemArticle(conf *Config, name string, item *gofeed.Item) {
+	feed := conf.Feeds[name]
+	if feed == nil || !feed.Readability || item.Link == "" || item.Custom[ItemFormat] == ItemFormatMarkdown {
+		return
+	}
+
+	article, err := FetchArticle(conf, name, item.Link)
+	if errors.Is(err, ErrNoArticle) {
+		log.WithField("name", name).Debugf("no article found at %s", item.Link)
+		return
+	} else if err != nil {
+		log.WithError(err).WithField("name", name).Warnf("error fetching article %s", item.Link)
+		return
+	}
+
+	text := func(content string) int {
+		return len(strings.TrimSpace(htmlTags.ReplaceAllString(content, "")))
+	}
+	if text(article) <= text(item.Description) || text(article) <= text(item.Content) {
+		return
+	}
+
+	item.Description = article
+	item.Content = article
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractArticle(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "readability", "article.html"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	article, err := ExtractArticle(f)
+	require.NoError(t, err)
+	assert.Contains(t, article, "Last month we rewrote the scheduler")
+	assert.Contains(t, article, "the design notes")
+	assert.Contains(t, article, "/images/scheduler.png")
+	assert.NotContains(t, article, "Popular posts")
+	assert.NotContains(t, article, "Great post")
+	assert.NotContains(t, article, "Copyright")
+	assert.NotContains(t, article, "analytics")
+
+	f, err = os.Open(filepath.Join("testdata", "readability", "index.html"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = ExtractArticle(f)
+	assert.ErrorIs(t, err, ErrNoArticle)
+}
+
+func TestReadability(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		http.ServeFile(w, r, filepath.Join("testdata", "readability", filepath.Base(r.URL.Path)))
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.Feeds["example"] = &Feed{Name: "example", Readability: true}
+
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := []*gofeed.Item{
+		{
+			Title:           "Rewriting the scheduler",
+			Description:     "We rewrote the scheduler.",
+			Link:            server.URL + "/article.html",
+			PublishedParsed: &published,
+		},
+		{
+			Title:           "Index",
+			Description:     "Everything we wrote.",
+			Link:            server.URL + "/index.html",
+			PublishedParsed: &published,
+		},
+	}
+	require.NoError(WriteFeedItems(conf, "example", items))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "example.txt"))
+	require.NoError(err)
+	require.Len(twts, 2)
+	assert.Contains(twts[0].Text, "Last month we rewrote the scheduler")
+	assert.Contains(twts[1].Text, "Everything we wrote.")
+
+	article, err := FetchArticle(conf, "example", server.URL+"/article.html")
+	require.NoError(err)
+	assert.Contains(article, "Last month we rewrote the scheduler")
+
+	_, err = FetchArticle(conf, "example", server.URL+"/index.html")
+	assert.ErrorIs(err, ErrNoArticle)
+
+	assert.Equal(1, requests["/article.html"])
+	assert.Equal(1, requests["/index.html"])
+}
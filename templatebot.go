@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/divan/num2words"
+)
+
+func init() {
+	RegisterBot("template", NewTemplateBot, false)
+}
+
+// BotContext is the context the template of a template bot is executed in.
+type BotContext struct {
+	Name  string
+	Now   time.Time
+	Vars  map[string]string
+	Lists map[string][]string
+}
+
+// TemplateBot twts its feed's template on its feed's schedule, for reminders,
+// prompts and countdowns and the like declared in the feeds' configuration.
+// Empty twts are not twted, and counters are only saved once a twt is.
+type TemplateBot struct {
+	conf     *Config
+	name     string
+	schedule string
+	bot      FeedBot
+	template *template.Template
+
+	mu       sync.Mutex
+	counters map[string]int
+	rand     *rand.Rand
+}
+
+func NewTemplateBot(conf *Config, name string, feed *Feed) (Bot, error) {
+	if feed.Schedule == "" {
+		return nil, fmt.Errorf("error: template bot %s has no schedule", name)
+	}
+	if feed.Bot == nil || feed.Bot.Template == "" {
+		return nil, fmt.Errorf("error: template bot %s has no template", name)
+	}
+
+	bot := &TemplateBot{
+		conf:     conf,
+		name:     name,
+		schedule: feed.Schedule,
+		bot:      *feed.Bot,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	tmpl, err := template.New(name).Funcs(twtTemplateFuncs).Funcs(bot.funcs()).Option("missingkey=error").Parse(feed.Bot.Template)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template of bot %s: %w", name, err)
+	}
+	bot.template = tmpl
+
+	return bot, nil
+}
+
+func (bot *TemplateBot) Name() string { return bot.name }
+
+func (bot *TemplateBot) Description() string {
+	return fmt.Sprintf("I am @%s an automated feed that twts on a schedule (%s)", bot.name, bot.schedule)
+}
+
+func (bot *TemplateBot) Schedule() string { return bot.schedule }
+
+func (bot *TemplateBot) Generate(ctx context.Context, now time.Time) ([]Twt, error) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	bot.counters = make(map[string]int)
+	if err := LoadState(bot.conf, bot.name, "counters", &bot.counters); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := bot.template.Execute(&buf, BotContext{Name: bot.name, Now: now, Vars: bot.bot.Vars, Lists: bot.bot.Lists}); err != nil {
+		return nil, fmt.Errorf("error executing template of bot %s: %w", bot.name, err)
+	}
+
+	text := CleanTwt(buf.String())
+	if text == "" {
+		bot.counters = nil
+		return nil, nil
+	}
+
+	return []Twt{{Created: now, Text: text}}, nil
+}
+
+// Commit saves the counters of the bot's last run, if it twted.
+func (bot *TemplateBot) Commit() error {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+
+	if bot.counters == nil {
+		return nil
+	}
+	return SaveState(bot.conf, bot.name, "counters", bot.counters)
+}
+
+// funcs returns the helpers of the bot's template, besides those of twt
+// templates:
+//
+//   - format "layout" t: the time t formatted with the Go layout
+//   - num2words n (or words n): the number n in words
+//   - list "a" "b" ...: a list of the values
+//   - choice list: a random value of the list
+//   - counter "name": the counter name incremented, counters are persisted
+//   - yearday t: the day of the year of the time t
+//   - daysuntil "2006-01-02" t: the days from the time t until the date
+func (bot *TemplateBot) funcs() template.FuncMap {
+	return template.FuncMap{
+		"format": func(layout string, t time.Time) string {
+			return t.Format(layout)
+		},
+		"num2words": num2words.Convert,
+		"words":     num2words.Convert,
+		"list": func(values ...string) []string {
+			return values
+		},
+		"choice": func(values []string) (string, error) {
+			if len(values) == 0 {
+				return "", fmt.Errorf("error: choice of nothing")
+			}
+			return values[bot.rand.Intn(len(values))], nil
+		},
+		"counter": func(name string) int {
+			bot.counters[name]++
+			return bot.counters[name]
+		},
+		"yearday": func(t time.Time) int {
+			return t.YearDay()
+		},
+		"daysuntil": func(date string, t time.Time) (int, error) {
+			until, err := time.ParseInLocation("2006-01-02", date, t.Location())
+			if err != nil {
+				return 0, err
+			}
+			today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+			return int(until.Sub(today).Hours() / 24), nil
+		},
+	}
+}
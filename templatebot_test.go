@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateBot(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.Feeds["standup"] = &Feed{
+		Name:     "standup",
+		Type:     FeedTypeBot,
+		Schedule: "0 0 9 * * 1-5",
+		Bot: &FeedBot{
+			Kind: "template",
+			Template: `Standup #{{ counter "standups" }} on {{ format "Monday" .Now }}, day {{ num2words (yearday .Now) }} of the year. ` +
+				`{{ choice .Lists.prompts }} {{ daysuntil .Vars.release .Now }} days until the release of {{ .Vars.name }}.`,
+			Vars:  map[string]string{"name": "v2", "release": "2021-01-15"},
+			Lists: map[string][]string{"prompts": {"What are you working on?"}},
+		},
+	}
+
+	bots, err := NewBots(conf)
+	require.NoError(err)
+	bot := bots["standup"]
+	require.NotNil(bot)
+	assert.Equal("0 0 9 * * 1-5", BotSchedule(conf, bot))
+
+	now := time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+	require.NoError(RunBot(conf, bot, now))
+	require.NoError(RunBot(conf, bot, now.Add(24*time.Hour)))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "standup.txt"))
+	require.NoError(err)
+	require.Len(twts, 2)
+	assert.Equal("Standup #1 on Monday, day four of the year. What are you working on? 11 days until the release of v2.", twts[0].Text)
+	assert.Equal("Standup #2 on Tuesday, day five of the year. What are you working on? 10 days until the release of v2.", twts[1].Text)
+	assert.Equal(now, twts[0].Created)
+
+	// Counters of runs whose twts were not written are not saved.
+	_, err = bot.Generate(context.Background(), now.Add(48*time.Hour))
+	require.NoError(err)
+	require.NoError(RunBot(conf, bot, now.Add(48*time.Hour)))
+	twts, err = ReadTwts(filepath.Join(conf.DataDir, "standup.txt"))
+	require.NoError(err)
+	require.Len(twts, 3)
+	assert.Contains(twts[2].Text, "Standup #3 on Wednesday, day six")
+}
+
+func TestTemplateBotErrors(t *testing.T) {
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+
+	_, err := NewTemplateBot(conf, "empty", &Feed{Schedule: "@daily", Bot: &FeedBot{}})
+	assert.Error(t, err)
+
+	_, err = NewTemplateBot(conf, "unscheduled", &Feed{Bot: &FeedBot{Template: "Hello"}})
+	assert.Error(t, err)
+
+	_, err = NewTemplateBot(conf, "invalid", &Feed{Schedule: "@daily", Bot: &FeedBot{Template: "{{ .Now"}})
+	assert.Error(t, err)
+
+	bot, err := NewTemplateBot(conf, "choice", &Feed{Schedule: "@daily", Bot: &FeedBot{Template: `{{ choice (list "a" "b") }}{{ if false }}x{{ end }}`}})
+	require.NoError(t, err)
+	twts, err := bot.Generate(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.Len(t, twts, 1)
+	assert.Contains(t, []string{"a", "b"}, twts[0].Text)
+
+	bot, err = NewTemplateBot(conf, "silent", &Feed{Schedule: "@daily", Bot: &FeedBot{Template: `{{ if eq (yearday .Now) 1 }}Happy new year!{{ end }}`}})
+	require.NoError(t, err)
+	twts, err = bot.Generate(context.Background(), time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, twts)
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	text_template "text/template"
+	"time"
 )
 
 // RenderPlainText ...
@@ -17,6 +19,27 @@ func RenderPlainText(tpl string, ctx interface{}) (string, error) {
 	return buf.String(), nil
 }
 
+// RenderPreamble renders the twtxt preamble of `feed` last modified at `lastModified`.
+func RenderPreamble(conf *Config, feed *Feed, lastModified time.Time) (string, error) {
+	ctx := map[string]interface{}{
+		"Name":         feed.Name,
+		"URL":          fmt.Sprintf("%s/%s/twtxt.txt", conf.BaseURL, feed.Name),
+		"Type":         feed.Type,
+		"Source":       feed.URI,
+		"Avatar":       feed.Avatar,
+		"Description":  feed.Description,
+		"LastModified": lastModified.UTC().Format(time.RFC3339),
+		"Link":         feed.Link,
+		"Lang":         feed.Lang,
+		"Refresh":      feed.Refresh,
+		"Follow":       feed.Follow,
+
+		"SoftwareVersion": FullVersion(),
+	}
+
+	return RenderPlainText(preambleTemplate, ctx)
+}
+
 const preambleTemplate = `# Twtxt is an open, distributed microblogging platform that
 # uses human-readable text files, common transport protocols,
 # and free software.
@@ -34,6 +57,18 @@ const preambleTemplate = `# Twtxt is an open, distributed microblogging platform
 {{ end -}}
 # avatar      = {{ .Avatar }}
 # description = {{ .Description }}
+{{ with .Link -}}
+# link        = Homepage {{ . }}
+{{ end -}}
+{{ with .Lang -}}
+# lang        = {{ . }}
+{{ end -}}
+{{ with .Refresh -}}
+# refresh     = {{ . }}
+{{ end -}}
+{{ range .Follow -}}
+# follow      = {{ . }}
+{{ end -}}
 # updated_at  = {{ .LastModified }}
 #
 `
@@ -59,7 +94,7 @@ const indexTemplate = `
       <div>
         <div class="container-fluid">
           <form action="/" method="POST">
-			<input type="uri" id="uri" name="uri" placeholder="Enter any Website's URL, an RSS/Atom feed URI, or mastodon://handle" required>
+			<input type="uri" id="uri" name="uri" placeholder="Enter any Website's URL, an RSS/Atom feed URI, mastodon://handle, twtxt+https://url or gemini://url" required>
             <div><button type="submit">Go!</button>
           </form>
         </div>
@@ -72,6 +107,12 @@ const indexTemplate = `
         <p>
           In addition there is also support for Mastodon (<i>which supports RSS feeds for user posts</i>) by entering a Mastodon handle, for example: <code>mastodon://user@domain</code> or <code>mastodon://@user@server</code>
         </p>
+        <p>
+          Other twtxt feeds can be mirrored too (<i>preserving their original timestamps</i>) by entering their URL prefixed with <code>twtxt+</code>, for example: <code>twtxt+https://example.com/twtxt.txt</code>
+        </p>
+        <p>
+          Gemlogs are supported as well by entering their <code>gemini://</code> URL, either a gemlog index (<i>following the Gemini subscription convention</i>) or an Atom feed served over Gemini.
+        </p>
         <p>
           You may freely create new feeds here by simply dropping a website's URL or any valid RSS/Atom URI.
           </p>
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// threadTemplate is the text of a twt continuing a thread, replying to the
+// thread's first twt by its twt hash.
+const threadTemplate = "(#%s) %s"
+
+// threadInterval is the offset of the timestamps of consecutive twts of a
+// thread, so they are in order and of distinct twt hashes.
+const threadInterval = time.Second
+
+// FormatItemThread renders the `item` of the feed `name` like FormatItem or,
+// if the feed threads long items and the item does not fit in a twt, as a
+// first twt with the item's title and link followed by continuation twts of
+// its content, which reply to the first one with ThreadTwt.
+func FormatItemThread(conf *Config, name string, item *gofeed.Item) (string, []string, error) {
+	return formatItemThread(conf, NewMentions(conf), name, item)
+}
+
+func formatItemThread(conf *Config, mentions *Mentions, name string, item *gofeed.Item) (string, []string, error) {
+	feed := conf.Feeds[name]
+	if feed == nil || feed.Thread < 2 || feed.Template != "" {
+		text, err := formatItem(conf, mentions, name, item, maxTwtLength)
+		return text, nil, err
+	}
+
+	full, err := formatItem(conf, mentions, name, item, math.MaxInt32)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(graphemes(full)) <= maxTwtLength {
+		return full, nil, nil
+	}
+
+	head := *item
+	head.Description = ""
+	first, err := formatItem(conf, mentions, name, &head, maxTwtLength)
+	if err != nil {
+		return "", nil, err
+	}
+
+	content := CleanTwt(mentions.Expand(name, itemMarkdown(feed, item, item.Description)))
+	if strings.TrimSpace(content) == "" {
+		return first, nil, nil
+	}
+
+	max := maxTwtLength - len(ThreadTwt(strings.Repeat("x", twtHashLength), "")) - len(truncationSuffix)
+
+	return first, SplitMarkdown(content, max, feed.Thread-1), nil
+}
+
+// ThreadTwt returns the text of a twt continuing the thread of the twt with
+// the twt hash `hash`.
+func ThreadTwt(hash, text string) string {
+	return fmt.Sprintf(threadTemplate, hash, text)
+}
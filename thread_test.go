@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatItemThread(t *testing.T) {
+	conf := NewConfig()
+	conf.Feeds["example"] = &Feed{Name: "example", Thread: 3}
+
+	item := &gofeed.Item{Title: "Short", Description: "Fits in a twt.", Link: "https://example.com/short"}
+	text, thread, err := FormatItemThread(conf, "example", item)
+	require.NoError(t, err)
+	assert.Equal(t, "**Short**\u2028Fits in a twt. ⌘ [Read more](https://example.com/short)", text)
+	assert.Empty(t, thread)
+
+	sentence := "This sentence is part of a rather long article that does not fit in a single twt. "
+	item = &gofeed.Item{Title: "Long", Description: strings.Repeat(sentence, 20), Link: "https://example.com/long"}
+	text, thread, err = FormatItemThread(conf, "example", item)
+	require.NoError(t, err)
+	assert.Equal(t, "**Long** ⌘ [Read more](https://example.com/long)", text)
+	require.Len(t, thread, 2)
+	assert.True(t, strings.HasPrefix(thread[0], "This sentence"))
+	assert.True(t, strings.HasSuffix(thread[1], truncationSuffix))
+	for _, part := range thread {
+		assert.LessOrEqual(t, len(graphemes(ThreadTwt("abcdefg", part))), maxTwtLength)
+	}
+
+	conf.Feeds["example"].Thread = 0
+	text, thread, err = FormatItemThread(conf, "example", item)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(text, "**Long**\u2028This sentence"))
+	assert.Empty(t, thread)
+}
+
+func TestWriteThread(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["example"] = &Feed{Name: "example", Thread: 3}
+
+	published := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	sentence := "This sentence is part of a rather long article that does not fit in a single twt. "
+	items := []*gofeed.Item{
+		{Title: "Long", Description: strings.Repeat(sentence, 20), Link: "https://example.com/long", PublishedParsed: &published},
+	}
+	require.NoError(WriteFeedItems(conf, "example", items))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "example.txt"))
+	require.NoError(err)
+	require.Len(twts, 3)
+
+	hash := twts[0].Hash(URLForFeed(conf, "example"))
+	for i, twt := range twts {
+		assert.Equal(published.Add(time.Duration(i)*time.Second), twt.Created.UTC())
+		if i > 0 {
+			assert.True(strings.HasPrefix(twt.Text, "(#"+hash+") "), twt.Text)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/divan/num2words"
+)
+
+func init() {
+	RegisterBot("tiktok", NewTikTokBot, true)
+}
+
+// tiktokSymbols are the clock faces of the times of day (as hhmm on a 12h
+// clock) the @tiktok bot twts at.
+var tiktokSymbols = map[int]string{
+	0: "🕛", 30: "🕧",
+	100: "🕐", 130: "🕜",
+	200: "🕑", 230: "🕝",
+	300: "🕒", 330: "🕞",
+	400: "🕓", 430: "🕟",
+	500: "🕔", 530: "🕠",
+	600: "🕕", 630: "🕡",
+	700: "🕖", 730: "🕢",
+	800: "🕗", 830: "🕣",
+	900: "🕘", 930: "🕤",
+	1000: "🕙", 1030: "🕥",
+	1100: "🕚", 1130: "🕦",
+	1200: "🕛", 1230: "🕧",
+}
+
+// TikTokBot twts the current time (UTC) every 30m, its feed only holds the
+// current time.
+type TikTokBot struct {
+	name string
+}
+
+func NewTikTokBot(conf *Config, name string, feed *Feed) (Bot, error) {
+	return &TikTokBot{name: name}, nil
+}
+
+func (bot *TikTokBot) Name() string { return bot.name }
+
+func (bot *TikTokBot) Description() string {
+	return fmt.Sprintf("I am @%s an automated feed that twts every 30m with the current time (UTC)", bot.name)
+}
+
+func (bot *TikTokBot) Schedule() string { return "0 0,30 * * * *" }
+
+func (bot *TikTokBot) Ephemeral() bool { return true }
+
+func (bot *TikTokBot) Generate(ctx context.Context, now time.Time) ([]Twt, error) {
+	now = now.UTC()
+
+	hour := now.Hour() % 12
+	min := now.Minute()
+
+	var key int
+
+	if hour == 0 {
+		key = hour + min
+	} else {
+		key = (hour * 100) + min
+	}
+	sym := tiktokSymbols[key]
+
+	var clock string
+
+	if hour == 0 {
+		clock = "twelve"
+	} else {
+		clock = num2words.Convert(hour)
+	}
+
+	if min == 0 {
+		clock += " o'clock"
+	} else if min == 30 {
+		clock += " thirty"
+	} else {
+		clock = fmt.Sprintf("%s past %s", num2words.Convert(min), clock)
+	}
+
+	if now.Hour() < 6 {
+		clock += " in the morning 😴"
+	} else if now.Hour() < 12 {
+		clock += " 🌞"
+	} else if now.Hour() < 18 {
+		clock += " in the afternoon 🌅"
+	} else {
+		clock += " in the evening 🌛"
+	}
+
+	return []Twt{{Created: now, Text: fmt.Sprintf("%s The time is now %s", sym, clock)}}, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Timestamps allocates the timestamps of twts written to a feed: in UTC to the
+// second, future-dated ones clamped to now, and unique within the feed so the
+// hashes of twts never collide. Future-dated items or twts are remembered by
+// their keys, as they are written with another timestamp than upstream's and
+// would otherwise be considered new again.
+type Timestamps struct {
+	conf *Config
+	name string
+	now  time.Time
+
+	used    map[int64]bool
+	future  map[string]int64 // key -> upstream timestamp of future-dated items
+	changed bool
+}
+
+// LoadTimestamps returns the timestamps of the feed `name` with those of the
+// twts it holds taken.
+func LoadTimestamps(conf *Config, name string) (*Timestamps, error) {
+	ts := &Timestamps{
+		conf:   conf,
+		name:   name,
+		now:    time.Now().UTC().Truncate(time.Second),
+		used:   make(map[int64]bool),
+		future: make(map[string]int64),
+	}
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading feed %s: %w", name, err)
+	}
+	for _, twt := range twts {
+		ts.used[twt.Created.Unix()] = true
+	}
+
+	if err := LoadState(conf, name, "future", &ts.future); err != nil {
+		return nil, err
+	}
+
+	return ts, nil
+}
+
+// Next returns the timestamp of a twt created at `t` of the item or twt
+// `key`, at `t` if it is not taken yet and otherwise the next second free,
+// or the last free one before if there is none up to now.
+func (ts *Timestamps) Next(key string, t time.Time) time.Time {
+	return ts.NextThread(key, t, 0)[0]
+}
+
+// NextThread is like Next for the first twt of a thread and its `n` more
+// twts, returning their timestamps. Those of the thread's twts follow the
+// first's by threadInterval and are no later than now either, so the first
+// is moved back as far as needed for the thread to fit.
+func (ts *Timestamps) NextThread(key string, t time.Time, n int) []time.Time {
+	t = t.UTC().Truncate(time.Second)
+	if t.After(ts.now) && key != "" {
+		ts.future[key] = t.Unix()
+		ts.changed = true
+	}
+
+	latest := ts.now.Add(-time.Duration(n) * threadInterval)
+	if t.After(latest) {
+		t = latest
+	}
+	for !ts.free(t, n) && t.Before(latest) {
+		t = t.Add(time.Second)
+	}
+	for !ts.free(t, n) {
+		t = t.Add(-time.Second)
+	}
+
+	var times []time.Time
+	for i := 0; i <= n; i++ {
+		created := t.Add(time.Duration(i) * threadInterval)
+		ts.used[created.Unix()] = true
+		times = append(times, created)
+	}
+
+	return times
+}
+
+// free returns true if the timestamp `t` and those of the `n` twts of a
+// thread following it are not taken.
+func (ts *Timestamps) free(t time.Time, n int) bool {
+	for i := 0; i <= n; i++ {
+		if ts.used[t.Add(time.Duration(i)*threadInterval).Unix()] {
+			return false
+		}
+	}
+	return true
+}
+
+// Written returns true if the future-dated item or twt `key` was written
+// before.
+func (ts *Timestamps) Written(key string) bool {
+	_, ok := ts.future[key]
+	return ok
+}
+
+// Prune forgets the future-dated items or twts whose upstream timestamps are
+// no later than the `cutoff` of what is considered new, as they are not
+// considered again anyway.
+func (ts *Timestamps) Prune(cutoff time.Time) {
+	for key, t := range ts.future {
+		if !time.Unix(t, 0).After(cutoff) {
+			delete(ts.future, key)
+			ts.changed = true
+		}
+	}
+}
+
+// Save saves the future-dated items or twts remembered.
+func (ts *Timestamps) Save() error {
+	if !ts.changed {
+		return nil
+	}
+	return SaveState(ts.conf, ts.name, "future", ts.future)
+}
+
+// sortItems returns the `items` with a publication date in chronological
+// order.
+func sortItems(items []*gofeed.Item) []*gofeed.Item {
+	var sorted []*gofeed.Item
+	for _, item := range items {
+		if item.PublishedParsed != nil {
+			sorted = append(sorted, item)
+		}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].PublishedParsed.Before(*sorted[j].PublishedParsed)
+	})
+
+	return sorted
+}
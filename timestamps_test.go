@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestamps(t *testing.T) {
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+
+	ts, err := LoadTimestamps(conf, "example")
+	require.NoError(t, err)
+
+	nz := time.FixedZone("NZDT", 13*60*60)
+	created := time.Date(2021, 1, 1, 13, 0, 0, 500, nz)
+	utc := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, utc, ts.Next("a", created))
+	assert.Equal(t, utc.Add(time.Second), ts.Next("b", created))
+	assert.Equal(t, utc.Add(2*time.Second), ts.Next("c", utc))
+
+	future := ts.Next("d", time.Now().Add(time.Hour))
+	assert.False(t, future.After(time.Now()))
+	assert.True(t, ts.Written("d"))
+	assert.False(t, ts.Written("a"))
+
+	// Another future-dated twt is not moved past now but before.
+	assert.Equal(t, ts.now, future)
+	assert.Equal(t, ts.now.Add(-time.Second), ts.Next("e", time.Now().Add(time.Hour)))
+
+	// Neither are the twts of a thread, the first is moved back instead.
+	assert.Equal(t, []time.Time{ts.now.Add(-4 * time.Second), ts.now.Add(-3 * time.Second), ts.now.Add(-2 * time.Second)},
+		ts.NextThread("f", time.Now().Add(time.Hour), 2))
+
+	require.NoError(t, ts.Save())
+	ts, err = LoadTimestamps(conf, "example")
+	require.NoError(t, err)
+	assert.True(t, ts.Written("d"))
+
+	ts.Prune(time.Now().Add(2 * time.Hour))
+	assert.False(t, ts.Written("d"))
+}
+
+func TestWriteFeedItemsTimestamps(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+
+	nz := time.FixedZone("NZDT", 13*60*60)
+	first := time.Date(2021, 1, 1, 13, 0, 0, 0, nz)
+	second := time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)
+	future := time.Now().Add(24 * time.Hour)
+	items := []*gofeed.Item{
+		{Title: "Second", GUID: "2", PublishedParsed: &second},
+		{Title: "Future", GUID: "3", PublishedParsed: &future},
+		{Title: "First", GUID: "1", PublishedParsed: &first},
+		{Title: "Also first", GUID: "1b", PublishedParsed: &first},
+	}
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", items))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "example.txt"))
+	require.NoError(err)
+	require.Len(twts, 4)
+
+	assert.Equal("**First**", twts[0].Text)
+	assert.Equal("2021-01-01T00:00:00Z", twts[0].Created.Format(time.RFC3339))
+	assert.Equal("**Also first**", twts[1].Text)
+	assert.Equal("2021-01-01T00:00:01Z", twts[1].Created.Format(time.RFC3339))
+	assert.Equal("**Second**", twts[2].Text)
+	assert.Equal("**Future**", twts[3].Text)
+	assert.False(twts[3].Created.After(time.Now()))
+
+	// Future-dated items are not written again.
+	require.NoError(AppendFeedItems(conf, "example", "https://example.com/rss.xml", items))
+	twts, err = ReadTwts(filepath.Join(conf.DataDir, "example.txt"))
+	require.NoError(err)
+	assert.Len(twts, 4)
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// truncationSuffix is appended to content that has been truncated.
+const truncationSuffix = " ..."
+
+// markdownSpan is a range [start, end) of runes of Markdown syntax, a link,
+// image, code span, URL or emphasis, the content is not cut inside of.
+type markdownSpan struct {
+	start, end int
+
+	// closer is the delimiter closing an emphasis span, which is re-added
+	// when the content is cut inside the span, otherwise the span can not be
+	// cut inside at all.
+	closer string
+	inner  int // the start of the span's content after its opener
+}
+
+// TruncateMarkdown truncates the Markdown `text` to at most `max` grapheme
+// clusters followed by " ..." if it is longer. The text is cut on a sentence
+// or word boundary, never inside a link, image, code span or URL, and
+// emphasis cut through is closed. Only when there is no such boundary is it
+// cut at `max` grapheme clusters, keeping just the text of a link or image
+// cut through and dropping a code span or URL cut through. A `max` below 0
+// is taken as 0.
+func TruncateMarkdown(text string, max int) string {
+	if max < 0 {
+		max = 0
+	}
+	if len(graphemes(text)) <= max {
+		return text
+	}
+
+	head, closer, _ := cutMarkdown(text, max)
+	return strings.TrimLeft(head+closer+truncationSuffix, " ")
+}
+
+// SplitMarkdown splits the Markdown `text` into at most `parts` parts of at
+// most `max` grapheme clusters each, cut like TruncateMarkdown does. Emphasis
+// cut through is closed at the end of a part and reopened in the next, and
+// the last part is truncated if the text does not fit.
+func SplitMarkdown(text string, max, parts int) []string {
+	var split []string
+	for max > 0 && len(split) < parts-1 && len(graphemes(text)) > max {
+		head, closer, rest := cutMarkdown(text, max)
+		split = append(split, head+closer)
+		text = reverse(closer) + rest
+	}
+
+	if text = TruncateMarkdown(text, max); text != "" {
+		split = append(split, text)
+	}
+	return split
+}
+
+// cutMarkdown cuts the Markdown `text`, which is longer than `max` grapheme
+// clusters, on a sentence or word boundary and returns the `head` before the
+// cut, the delimiters closing emphasis cut through and the `rest` after it.
+func cutMarkdown(text string, max int) (head, closer, rest string) {
+	clusters := graphemes(text)
+
+	runes := []rune(text)
+	spans := markdownSpans(runes)
+
+	// offsets[i] is the rune offset of the i'th cluster
+	offsets := make([]int, len(clusters)+1)
+	for i, cluster := range clusters {
+		offsets[i+1] = offsets[i] + len([]rune(cluster))
+	}
+
+	var (
+		word, sentence         = -1, -1
+		wordClose, sentenceEnd string
+	)
+	for p := max; p > 0; p-- {
+		if !isWordBoundary(clusters[p-1], clusters[p]) {
+			continue
+		}
+
+		closer, ok := cutAt(spans, offsets[p])
+		if !ok || p+len([]rune(closer)) > max {
+			continue
+		}
+
+		if word == -1 {
+			word, wordClose = p, closer
+		}
+		if isSentenceEnd(clusters[p-1]) && isSpace(clusters[p]) {
+			sentence, sentenceEnd = p, closer
+			break
+		}
+	}
+
+	cut, closer := word, wordClose
+	if sentence != -1 && sentence >= max*3/4 {
+		cut, closer = sentence, sentenceEnd
+	}
+
+	hardCut := func() (string, string, string) {
+		return hardCutMarkdown(runes, spans, offsets[max], max)
+	}
+
+	if cut == -1 {
+		return hardCut()
+	}
+
+	head = strings.TrimRightFunc(string(runes[:offsets[cut]]), func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",;:-–—([{@#", r)
+	})
+	if head == "" {
+		return hardCut()
+	}
+
+	return head, closer, strings.TrimLeftFunc(string(runes[offsets[cut]:]), unicode.IsSpace)
+}
+
+// hardCutMarkdown cuts the Markdown `runes` at rune offset `p`, at most `max`
+// grapheme clusters, and returns the head before the cut and the rest after
+// it. A link or image cut through is replaced by its text in the head, and a
+// code span or URL cut through is left to the rest.
+func hardCutMarkdown(runes []rune, spans []markdownSpan, p, max int) (string, string, string) {
+	for _, span := range spans {
+		if span.closer != "" || p <= span.start || p >= span.end {
+			continue
+		}
+
+		head := strings.TrimRightFunc(string(runes[:span.start]), unicode.IsSpace)
+		rest := string(runes[span.start:])
+
+		start := span.start
+		if runes[start] == '!' {
+			start++
+		}
+		if runes[start] == '[' {
+			label := runes[start+1 : matching(runes, start, '[', ']')]
+			head = string(runes[:span.start]) + string(label)
+			rest = strings.TrimLeftFunc(string(runes[span.end:]), unicode.IsSpace)
+		}
+
+		if clusters := graphemes(head); len(clusters) > max {
+			head = strings.Join(clusters[:max], "")
+		}
+		return head, "", rest
+	}
+
+	return string(runes[:p]), "", string(runes[p:])
+}
+
+// reverse returns the string `s` reversed, which turns the closing delimiters
+// of nested emphasis into their opening ones.
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// cutAt returns whether the text can be cut at rune offset `p` given its
+// Markdown `spans` and if so the delimiters closing emphasis cut through.
+func cutAt(spans []markdownSpan, p int) (string, bool) {
+	var closers []string
+	for _, span := range spans {
+		if p <= span.start || p >= span.end {
+			continue
+		}
+		if span.closer == "" || p <= span.inner || p > span.end-len(span.closer) {
+			return "", false
+		}
+		closers = append(closers, span.closer)
+	}
+
+	// Spans are in order of their opener, so close them inside out.
+	var sb strings.Builder
+	for i := len(closers) - 1; i >= 0; i-- {
+		sb.WriteString(closers[i])
+	}
+	return sb.String(), true
+}
+
+// markdownSpans returns the spans of Markdown syntax in `runes` in order of
+// their start.
+func markdownSpans(runes []rune) []markdownSpan {
+	var spans []markdownSpan
+
+	hasPrefix := func(i int, prefix string) bool {
+		end := i + len(prefix)
+		if end > len(runes) {
+			end = len(runes)
+		}
+		return strings.HasPrefix(string(runes[i:end]), prefix)
+	}
+
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '`':
+			n := runLength(runes, i, '`')
+			if end := findRun(runes, i+n, '`', n); end != -1 {
+				spans = append(spans, markdownSpan{start: i, end: end + n})
+				i = end + n - 1
+				continue
+			}
+			i += n - 1
+		case r == '[' || (r == '!' && hasPrefix(i, "![")):
+			if end := linkEnd(runes, i); end != -1 {
+				spans = append(spans, markdownSpan{start: i, end: end})
+				i = end - 1
+			}
+		case r == '<':
+			if end := indexRune(runes, i+1, '>'); end != -1 {
+				spans = append(spans, markdownSpan{start: i, end: end + 1})
+				i = end
+			}
+		case (r == 'h' && (hasPrefix(i, "http://") || hasPrefix(i, "https://"))) && (i == 0 || !isWordRune(runes[i-1])):
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			spans = append(spans, markdownSpan{start: i, end: end})
+			i = end - 1
+		case r == '*' || r == '_' || r == '~':
+			n := runLength(runes, i, r)
+			if (r == '~' && n != 2) || n > 3 || i+n >= len(runes) || unicode.IsSpace(runes[i+n]) ||
+				(r == '_' && i > 0 && isWordRune(runes[i-1])) {
+				i += n - 1
+				continue
+			}
+			if end := findRun(runes, i+n, r, n); end != -1 && !unicode.IsSpace(runes[end-1]) {
+				closer := strings.Repeat(string(r), n)
+				spans = append(spans, markdownSpan{start: i, end: end + n, closer: closer, inner: i + n})
+			}
+			i += n - 1
+		}
+	}
+
+	return spans
+}
+
+// linkEnd returns the end of the link or image starting at `i`, or -1 if
+// there is none.
+func linkEnd(runes []rune, i int) int {
+	if runes[i] == '!' {
+		i++
+	}
+
+	end := matching(runes, i, '[', ']')
+	if end == -1 || end+1 >= len(runes) {
+		return -1
+	}
+
+	switch runes[end+1] {
+	case '(':
+		if close := matching(runes, end+1, '(', ')'); close != -1 {
+			return close + 1
+		}
+	case '[':
+		if close := matching(runes, end+1, '[', ']'); close != -1 {
+			return close + 1
+		}
+	}
+
+	return -1
+}
+
+// matching returns the index of the bracket `close` matching the bracket
+// `open` at `i`, or -1 if there is none.
+func matching(runes []rune, i int, open, close rune) int {
+	depth := 0
+	for j := i; j < len(runes); j++ {
+		switch runes[j] {
+		case '\\':
+			j++
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// indexRune returns the index of `r` from `i` on the same line, or -1 if
+// there is none.
+func indexRune(runes []rune, i int, r rune) int {
+	for j := i; j < len(runes); j++ {
+		if runes[j] == r {
+			return j
+		}
+		if runes[j] == '\n' || runes[j] == '\u2028' || runes[j] == '<' {
+			return -1
+		}
+	}
+	return -1
+}
+
+func runLength(runes []rune, i int, r rune) int {
+	n := 0
+	for i+n < len(runes) && runes[i+n] == r {
+		n++
+	}
+	return n
+}
+
+// findRun returns the index of the next run of exactly `n` runes `r` from
+// `i`, or -1 if there is none.
+func findRun(runes []rune, i int, r rune, n int) int {
+	for j := i; j < len(runes); {
+		if runes[j] != r {
+			j++
+			continue
+		}
+		m := runLength(runes, j, r)
+		if m == n {
+			return j
+		}
+		j += m
+	}
+	return -1
+}
+
+// graphemes splits `s` into (an approximation of) its grapheme clusters, so
+// combining marks, emoji modifiers, ZWJ sequences and flags are kept whole.
+func graphemes(s string) []string {
+	var (
+		clusters []string
+		current  []rune
+		joined   bool // the previous rune was a zero width joiner
+		flags    int  // the number of regional indicators in the current cluster
+	)
+
+	for _, r := range s {
+		extends := len(current) > 0 && (joined ||
+			unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+			(r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF) ||
+			r == 0x200D || r == 0x20E3 ||
+			(r >= 0x1F3FB && r <= 0x1F3FF) ||
+			(r >= 0xE0020 && r <= 0xE007F) ||
+			(isRegionalIndicator(r) && flags == 1))
+
+		if !extends && len(current) > 0 {
+			clusters = append(clusters, string(current))
+			current, flags = nil, 0
+		}
+
+		current = append(current, r)
+		joined = r == 0x200D
+		if isRegionalIndicator(r) {
+			flags++
+		}
+	}
+
+	if len(current) > 0 {
+		clusters = append(clusters, string(current))
+	}
+
+	return clusters
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '\'' || r == '’'
+}
+
+func firstRune(cluster string) rune {
+	for _, r := range cluster {
+		return r
+	}
+	return 0
+}
+
+func isSpace(cluster string) bool {
+	return unicode.IsSpace(firstRune(cluster))
+}
+
+func isSentenceEnd(cluster string) bool {
+	return strings.ContainsRune(".!?…", firstRune(cluster))
+}
+
+// isWordBoundary returns true if the text can be cut between the clusters
+// `a` and `b`, that is not in the middle of a word.
+func isWordBoundary(a, b string) bool {
+	return !isWordRune(firstRune(a)) || !isWordRune(firstRune(b))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateMarkdown(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		max      int
+		expected string
+	}{
+		{"short", "Hello World", 20, "Hello World"},
+		{"word boundary", "Hello wonderful World", 14, "Hello ..."},
+		{"sentence boundary", "One sentence. Another sentence here", 20, "One sentence. ..."},
+		{"trailing punctuation", "Hello, wonderful World", 10, "Hello ..."},
+		{"link", "See [the docs](https://example.com/docs) for more", 30, "See ..."},
+		{"image", "An ![image](https://example.com/a.png) here", 20, "An ..."},
+		{"url", "Visit https://example.com/a/long/path now", 25, "Visit ..."},
+		{"code", "Run `go test ./...` now", 15, "Run ..."},
+		{"mention", "Hello @<prologic https://twtxt.net/user/prologic/twtxt.txt> hi", 30, "Hello ..."},
+		{"bold", "Some **bold text here** after", 20, "Some **bold text** ..."},
+		{"italic", "Some _italic text here_ after", 20, "Some _italic text_ ..."},
+		{"snake_case", "call some_function_name now please", 26, "call some_function_name ..."},
+		{"emoji", "Hi 👋🏽👋🏽👋🏽👋🏽", 5, "Hi 👋🏽👋🏽 ..."},
+		{"zwj", "👨‍👩‍👧👨‍👩‍👧👨‍👩‍👧", 2, "👨‍👩‍👧👨‍👩‍👧 ..."},
+		{"flags", "🇳🇿🇦🇺🇬🇧", 2, "🇳🇿🇦🇺 ..."},
+		{"combining", "café café café", 6, "café ..."},
+		{"no boundary", "Supercalifragilistic", 5, "Super ..."},
+		{"link only", "[the docs](https://example.com/docs)", 10, "the docs ..."},
+		{"long link only", "[the documentation](https://example.com/docs)", 7, "the doc ..."},
+		{"url only", "https://example.com/docs/index.html", 10, "..."},
+		{"zero", "Hello World", 0, "..."},
+		{"negative", "Hello World", -5, "..."},
+		{"empty", "", -5, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, TruncateMarkdown(testCase.text, testCase.max))
+		})
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	assert.Equal(t, []string{"a", "👋🏽", "🇳🇿", "é", "1️⃣", "👨‍👩‍👧"}, graphemes("a👋🏽🇳🇿é1️⃣👨‍👩‍👧"))
+}
+
+func TestSplitMarkdown(t *testing.T) {
+	assert.Equal(t, []string{"Hello World"}, SplitMarkdown("Hello World", 20, 3))
+	assert.Equal(t, []string{"One sentence.", "Another one.", "And another one ..."}, SplitMarkdown("One sentence. Another one. And another one here.", 15, 3))
+	assert.Equal(t, []string{"Some **bold text**", "**here** after"}, SplitMarkdown("Some **bold text here** after", 20, 2))
+	assert.Equal(t, []string{"Super", "calif", "ragil ..."}, SplitMarkdown("Supercalifragilistic", 5, 3))
+	assert.Empty(t, SplitMarkdown("", 5, 3))
+	assert.Equal(t, []string{"..."}, SplitMarkdown("Hello World", 0, 3))
+}
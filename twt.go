@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// twtHashLength is the length of (abbreviated) twt hashes.
+const twtHashLength = 7
+
+// Twt is a single twtxt entry, a timestamp and its text.
+type Twt struct {
+	Created time.Time
+	Text    string
+}
+
+// Hash returns the twt hash of the twt of the feed `url`.
+func (twt Twt) Hash(url string) string {
+	return TwtHash(url, twt.Created, twt.Text)
+}
+
+// TwtHash returns the hash Yarn identifies the twt `text` created at `created`
+// in the feed `url` by, as referenced by the `(#hash)` subject of replies.
+func TwtHash(url string, created time.Time, text string) string {
+	payload := fmt.Sprintf("%s\n%s\n%s", url, created.UTC().Format(time.RFC3339), text)
+	hash := FastHashString(payload)
+	return hash[len(hash)-twtHashLength:]
+}
+
+// Twtxt is a parsed twtxt feed, its metadata comments and its twts.
+type Twtxt struct {
+	Meta map[string][]string
+	Twts []Twt
+}
+
+// Get returns the first value of the metadata field `key` or an empty string.
+func (t *Twtxt) Get(key string) string {
+	if values := t.Meta[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ParseTimestamp parses a twt's timestamp as found in the wild, which is
+// mostly RFC3339 but sometimes lacks seconds.
+func ParseTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, time.RFC3339Nano, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("error: invalid twt timestamp %q", s)
+}
+
+// ParseTwtxt parses a twtxt feed from `r`, collecting `# key = value`
+// metadata comments and twts. Lines that are neither are silently skipped.
+func ParseTwtxt(r io.Reader) (*Twtxt, error) {
+	twtxt := &Twtxt{Meta: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if strings.HasPrefix(line, "#") {
+			kv := strings.SplitN(strings.TrimPrefix(line, "#"), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			if key == "" || strings.ContainsAny(key, " \t") {
+				continue
+			}
+			twtxt.Meta[key] = append(twtxt.Meta[key], strings.TrimSpace(kv[1]))
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		created, err := ParseTimestamp(strings.TrimSpace(parts[0]))
+		if err != nil {
+			continue
+		}
+
+		text := strings.TrimSpace(parts[1])
+		if text == "" {
+			continue
+		}
+
+		twtxt.Twts = append(twtxt.Twts, Twt{Created: created, Text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading twtxt feed: %w", err)
+	}
+
+	return twtxt, nil
+}
+
+// ReadTwts reads all twts from the feed file `fn`, a missing file has no twts.
+func ReadTwts(fn string) ([]Twt, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	twtxt, err := ParseTwtxt(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return twtxt.Twts, nil
+}
+
+// AppendNewTwts appends the `twts` to the feed `name` that it does not already
+// hold, in chronological order and preserving their timestamps as far as
+// Timestamps allows. Only twts newer than what the feed holds are considered,
+// so a rotated (empty) feed does not get the whole upstream history again.
+func AppendNewTwts(conf *Config, name string, twts []Twt) error {
+	fn := filepath.Join(conf.DataDir, fmt.Sprintf("%s.txt", name))
+
+	existing, err := ReadTwts(fn)
+	if err != nil {
+		return fmt.Errorf("error reading feed %s: %w", name, err)
+	}
+
+	var (
+		cutoff time.Time
+		exists bool
+	)
+	if stat, err := os.Stat(fn); err == nil {
+		cutoff, exists = stat.ModTime(), true
+	}
+	seen := make(map[string]bool)
+	for _, twt := range existing {
+		seen[twtKey(twt)] = true
+		if twt.Created.Before(cutoff) {
+			cutoff = twt.Created
+		}
+	}
+	if conf.backfilling(name) {
+		cutoff = time.Time{}
+
+		// Twts written to the feed's archives are not written again either.
+		err := readFeedTwts(fn, func(twt Twt) {
+			seen[twtKey(twt)] = true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	ts, err := LoadTimestamps(conf, name)
+	if err != nil {
+		return err
+	}
+	ts.Prune(cutoff)
+
+	f, err := os.OpenFile(fn, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sort.SliceStable(twts, func(i, j int) bool { return twts[i].Created.Before(twts[j].Created) })
+
+	filters := feedFilters(conf, name)
+
+	var newTwts []Twt
+	for _, twt := range twts {
+		if !twt.Created.After(cutoff) || seen[twtKey(twt)] || ts.Written(twtKey(twt)) {
+			continue
+		}
+		if allowed, rule := filters.AllowTwt(twt); !allowed {
+			log.WithField("name", name).Debugf("skipping %q (%v)", twt.Text, rule)
+			continue
+		}
+		seen[twtKey(twt)] = true
+		newTwts = append(newTwts, twt)
+	}
+
+	limited := newestTwts(newTwts, conf.ItemLimit(name, exists))
+	if skipped := len(newTwts) - len(limited); skipped > 0 {
+		log.WithField("name", name).Infof("skipping %d older twts over the limit of %d", skipped, len(limited))
+	}
+
+	new := 0
+	for _, twt := range limited {
+		if err := AppendTwt(f, twt.Text, ts.Next(twtKey(twt), twt.Created)); err != nil {
+			return err
+		}
+		new++
+	}
+
+	if err := ts.Save(); err != nil {
+		return err
+	}
+
+	if new > 0 {
+		conf.NotifyFeedUpdated(name)
+	}
+
+	return nil
+}
+
+func twtKey(twt Twt) string {
+	return fmt.Sprintf("%d\t%s", twt.Created.Unix(), strings.TrimSpace(twt.Text))
+}
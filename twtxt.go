@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gosimple/slug"
+	log "github.com/sirupsen/logrus"
+)
+
+// TwtxtSourceURL returns the upstream URL of a `twtxt+https://` (or
+// `twtxt://`, which implies https) source.
+func TwtxtSourceURL(uri string) (string, error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Type != "twtxt" {
+		return "", fmt.Errorf("error: not a twtxt uri %q", uri)
+	}
+
+	scheme := u.SubType
+	if scheme == "" {
+		scheme = "https"
+	}
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("error: unsupported twtxt transport %q", scheme)
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, u.Rest), nil
+}
+
+// FetchTwtxt fetches and parses the twtxt feed of a `twtxt+https://` source.
+func FetchTwtxt(uri string) (*Twtxt, error) {
+	src, err := TwtxtSourceURL(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := HTTPGet(src)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return ParseTwtxt(res.Body)
+}
+
+// ValidateTwtxtFeed validates a twtxt feed to be mirrored given a `uri` and
+// returns a `Feed` object on success or a zero-value `Feed` object and `error`
+// on an error.
+func ValidateTwtxtFeed(conf *Config, uri string) (Feed, error) {
+	twtxt, err := FetchTwtxt(uri)
+	if err != nil {
+		return Feed{}, fmt.Errorf("error fetching twtxt feed %q: %w", uri, err)
+	}
+
+	src, _ := TwtxtSourceURL(uri)
+
+	name := slug.Make(twtxtNick(twtxt, src))
+	if name == "" {
+		return Feed{}, fmt.Errorf("error: unable to determine a name for %q", uri)
+	}
+
+	var avatar string
+	if avatarURL := twtxt.Get("avatar"); avatarURL != "" {
+		opts := &ImageOptions{
+			Resize:  true,
+			ResizeW: avatarResolution,
+			ResizeH: avatarResolution,
+		}
+
+		fn := fmt.Sprintf("%s.png", name)
+
+		if err := DownloadImage(conf, avatarURL, fn, opts); err != nil {
+			log.WithError(err).Warnf("error downloading feed avatar from %s", avatarURL)
+		} else {
+			avatar = fmt.Sprintf("%s/%s/avatar.png", conf.BaseURL, name)
+			if avatarHash, err := FastHashFile(filepath.Join(conf.DataDir, fn)); err == nil {
+				avatar += "#" + avatarHash
+			} else {
+				log.WithError(err).Warnf("error updating avatar hash for %s", name)
+			}
+		}
+	}
+
+	return Feed{
+		Name:        name,
+		URI:         uri,
+		Avatar:      avatar,
+		Description: CleanDesc(twtxt.Get("description")),
+		Type:        FeedTypeTwtxt,
+		Link:        twtxtLink(twtxt),
+		Lang:        normalizeLang(twtxt.Get("lang")),
+		Refresh:     twtxtRefresh(twtxt),
+	}, nil
+}
+
+// UpdateTwtxtFeed mirrors the twts of the twtxt feed `uri`, and any further
+// `Sources` configured for the feed `name`, into our own feed preserving their
+// original timestamps. When several sources are merged each twt is prefixed
+// with a mention of the feed it came from.
+func UpdateTwtxtFeed(conf *Config, name, uri string) error {
+	sources := []string{uri}
+	if feed := conf.Feeds[name]; feed != nil {
+		sources = append(sources, feed.Sources...)
+	}
+
+	var (
+		twts    []Twt
+		follows []string
+	)
+	for i, source := range sources {
+		twtxt, err := FetchTwtxt(source)
+		if err != nil {
+			log.WithError(err).Warnf("error fetching twtxt source %s for %s", source, name)
+			continue
+		}
+
+		if i == 0 {
+			updateFeedMeta(conf, name, twtxtLink(twtxt), twtxt.Get("lang"), twtxtRefresh(twtxt))
+		}
+
+		var mention string
+		if len(sources) > 1 {
+			src, _ := TwtxtSourceURL(source)
+			nick := twtxtNick(twtxt, src)
+			mention = fmt.Sprintf("@<%s %s> ", nick, src)
+			follows = append(follows, fmt.Sprintf("%s %s", nick, src))
+		}
+
+		for _, twt := range twtxt.Twts {
+			twt.Text = mention + twt.Text
+			twts = append(twts, twt)
+		}
+	}
+
+	if feed := conf.Feeds[name]; feed != nil && len(follows) > 0 && feed.SetFollows(follows) {
+		saveFeedMeta(conf, name, feed)
+	}
+
+	return AppendNewTwts(conf, name, twts)
+}
+
+// twtxtLink returns the URL of the first `link` of a twtxt feed, whose links
+// are of the form `title url`.
+func twtxtLink(twtxt *Twtxt) string {
+	fields := strings.Fields(twtxt.Get("link"))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// twtxtRefresh returns the refresh interval advertised by a twtxt feed or
+// otherwise derived from its twts.
+func twtxtRefresh(twtxt *Twtxt) int {
+	if refresh := parseRefresh(twtxt.Get("refresh")); refresh > 0 {
+		return refresh
+	}
+	return RefreshInterval(twtTimes(twtxt.Twts))
+}
+
+// twtxtNick returns the nick advertised by a twtxt feed, falling back to the
+// hostname it is served from.
+func twtxtNick(twtxt *Twtxt, src string) string {
+	if nick := twtxt.Get("nick"); nick != "" {
+		return nick
+	}
+	if u, err := url.Parse(src); err == nil {
+		return u.Hostname()
+	}
+	return src
+}
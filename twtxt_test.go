@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTwtxt = `# nick        = alice
+# description = Alice's feed
+# follow      = bob https://example.com/bob.txt
+# follow      = carol https://example.com/carol.txt
+2021-01-01T00:00:00Z	Hello World!
+# a comment that is not metadata
+2021-01-02T10:30+01:00	No seconds here
+not a twt
+2021-01-03T00:00:00Z
+`
+
+func TestParseTwtxt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	twtxt, err := ParseTwtxt(strings.NewReader(testTwtxt))
+	require.NoError(err)
+
+	assert.Equal("alice", twtxt.Get("nick"))
+	assert.Equal("Alice's feed", twtxt.Get("description"))
+	assert.Len(twtxt.Meta["follow"], 2)
+	assert.Equal("", twtxt.Get("missing"))
+
+	require.Len(twtxt.Twts, 2)
+	assert.Equal("Hello World!", twtxt.Twts[0].Text)
+	assert.Equal("2021-01-02T09:30:00Z", twtxt.Twts[1].Created.UTC().Format("2006-01-02T15:04:05Z07:00"))
+}
+
+func TestUpdateTwtxtFeed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	body := testTwtxt
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+
+	uri := "twtxt+" + server.URL + "/twtxt.txt"
+	require.NoError(UpdateTwtxtFeed(conf, "alice", uri))
+
+	twts, err := ReadTwts(filepath.Join(conf.DataDir, "alice.txt"))
+	require.NoError(err)
+	require.Len(twts, 2)
+	assert.Equal("Hello World!", twts[0].Text)
+	assert.Equal(int64(1609579800), twts[1].Created.Unix())
+
+	// Mirroring again does not duplicate twts already held.
+	require.NoError(UpdateTwtxtFeed(conf, "alice", uri))
+	twts, err = ReadTwts(filepath.Join(conf.DataDir, "alice.txt"))
+	require.NoError(err)
+	assert.Len(twts, 2)
+
+	// New upstream twts are appended, future-dated ones clamped to now.
+	body += "2999-01-01T00:00:00Z\tFrom the future\n"
+	require.NoError(UpdateTwtxtFeed(conf, "alice", uri))
+	data, err := os.ReadFile(filepath.Join(conf.DataDir, "alice.txt"))
+	require.NoError(err)
+	assert.Contains(string(data), "\tFrom the future\n")
+	assert.NotContains(string(data), "2999-01-01T00:00:00Z")
+
+	require.NoError(UpdateTwtxtFeed(conf, "alice", uri))
+	twts, err = ReadTwts(filepath.Join(conf.DataDir, "alice.txt"))
+	require.NoError(err)
+	require.Len(twts, 3)
+	assert.False(twts[2].Created.After(time.Now()))
+}
+
+func TestUpdateTwtxtFeedMeta(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nick := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".txt")
+		fmt.Fprintf(w, "# nick = %s\n# link = Blog https://%s.example.com/\n# lang = en\n# refresh = 600\n2021-01-01T00:00:00Z\tHello from %s\n", nick, nick, nick)
+	}))
+	defer server.Close()
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.FeedsFile = filepath.Join(conf.DataDir, "feeds.yaml")
+	conf.Feeds["merged"] = &Feed{Name: "merged", Sources: []string{"twtxt+" + server.URL + "/bob.txt"}}
+
+	require.NoError(UpdateTwtxtFeed(conf, "merged", "twtxt+"+server.URL+"/alice.txt"))
+
+	feed := conf.Feeds["merged"]
+	assert.Equal("https://alice.example.com/", feed.Link)
+	assert.Equal("en", feed.Lang)
+	assert.Equal(600, feed.Refresh)
+	assert.Equal([]string{
+		"alice " + server.URL + "/alice.txt",
+		"bob " + server.URL + "/bob.txt",
+	}, feed.Follow)
+
+	// The metadata is persisted alongside, not in, the feeds file.
+	assert.NoFileExists(conf.FeedsFile)
+	require.NoError(os.WriteFile(conf.FeedsFile, []byte("---\nmerged:\n  name: merged\n"), 0644))
+
+	reloaded := NewConfig()
+	reloaded.DataDir = conf.DataDir
+	reloaded.FeedsFile = conf.FeedsFile
+	require.NoError(reloaded.LoadFeeds())
+	assert.Equal("https://alice.example.com/", reloaded.Feeds["merged"].Link)
+	assert.Equal(600, reloaded.Feeds["merged"].Refresh)
+	assert.Len(reloaded.Feeds["merged"].Follow, 2)
+}
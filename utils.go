@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/base32"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
@@ -29,6 +30,31 @@ var (
 	ErrInvalidImage = errors.New("error: invalid image")
 )
 
+// httpClient is the shared client used to fetch upstream sources.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// HTTPGet fetches `uri` with the shared client, identifying ourselves by our
+// User-Agent, and returns an error on any non-2xx response.
+func HTTPGet(uri string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("feeds/%s", FullVersion()))
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode/100 != 2 {
+		res.Body.Close()
+		return nil, fmt.Errorf("error: unexpected response %s from %s", res.Status, uri)
+	}
+
+	return res, nil
+}
+
 // CleanDesc cleans a piece of text suitable as a "description" (# description = )
 // or a profile's tagline. This is mostly used to cleanup shit data from sources
 // like Mastodon that have `\r\n`(s) in their feed's descriptions :/
@@ -252,3 +278,42 @@ func FastHashFile(fn string) (string, error) {
 	}
 	return FastHash(data), nil
 }
+
+// StateFile returns the path of the `kind` state file of the feed `name`.
+func StateFile(conf *Config, name, kind string) string {
+	return filepath.Join(conf.DataDir, fmt.Sprintf("%s.%s.json", name, kind))
+}
+
+// LoadState loads the `kind` state of the feed `name` into `v`, a missing
+// state file leaves `v` untouched.
+func LoadState(conf *Config, name, kind string, v interface{}) error {
+	data, err := os.ReadFile(StateFile(conf, name, kind))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading %s state for %s: %w", kind, name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s state for %s: %w", kind, name, err)
+	}
+
+	return nil
+}
+
+// SaveState atomically saves `v` as the `kind` state of the feed `name`.
+func SaveState(conf *Config, name, kind string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error serializing %s state for %s: %w", kind, name, err)
+	}
+
+	fn := StateFile(conf, name, kind)
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s state for %s: %w", kind, name, err)
+	}
+
+	return os.Rename(tmp, fn)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// webSubLeaseSeconds is the lease we ask hubs for, hubs may grant another
+	webSubLeaseSeconds = 7 * 24 * 60 * 60 // 7 days
+
+	// webSubRenewBefore is how long before a lease expires it is renewed
+	webSubRenewBefore = 24 * time.Hour
+
+	// webSubRetryAfter is how long a pending (unverified) subscription is
+	// waited on before subscribing again
+	webSubRetryAfter = time.Hour
+)
+
+// WebSubSubscription is a subscription to a feed's WebSub hub. Secret is the
+// secret of the subscription verified by the hub and Pending the secret of a
+// subscription request of ours awaiting verification, which only replaces
+// Secret once the hub verifies it. Subscriptions are persisted as the feed's
+// `websub` state rather than in the feeds file.
+type WebSubSubscription struct {
+	Hub      string    `json:"hub"`
+	Topic    string    `json:"topic"`
+	Secret   string    `json:"secret,omitempty"`
+	Pending  string    `json:"pending,omitempty"`
+	Verified bool      `json:"verified,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Updated  time.Time `json:"updated,omitempty"`
+}
+
+// Active returns true if the subscription is verified and its lease has not
+// lapsed, in which case the feed need not be polled.
+func (sub *WebSubSubscription) Active(now time.Time) bool {
+	return sub != nil && sub.Verified && now.Before(sub.Expires)
+}
+
+// NeedsRenewal returns true if the subscription's lease is about to lapse (or
+// has lapsed) and is not already pending with its hub.
+func (sub *WebSubSubscription) NeedsRenewal(now time.Time) bool {
+	if sub == nil {
+		return true
+	}
+	if !sub.Verified {
+		return now.Sub(sub.Updated) > webSubRetryAfter
+	}
+	return now.Add(webSubRenewBefore).After(sub.Expires) && now.Sub(sub.Updated) > webSubRetryAfter
+}
+
+// loadWebSub sets the subscription of the `feed` named `name` to its WebSub
+// hub saved before, if any.
+func loadWebSub(conf *Config, name string, feed *Feed) error {
+	var sub *WebSubSubscription
+	if err := LoadState(conf, name, "websub", &sub); err != nil {
+		return err
+	}
+	feed.webSub = sub
+	return nil
+}
+
+// saveWebSub saves the subscription of the `feed` named `name` to its WebSub
+// hub.
+func saveWebSub(conf *Config, name string, feed *Feed) error {
+	return SaveState(conf, name, "websub", feed.webSub)
+}
+
+// WebSubCallbackURL returns our callback URL for the subscription of the feed `name`.
+func WebSubCallbackURL(conf *Config, name string) string {
+	return fmt.Sprintf("%s/websub/callback/%s", strings.TrimSuffix(conf.BaseURL, "/"), name)
+}
+
+// DiscoverWebSubHub discovers the WebSub hub and topic (self) URLs of a feed
+// from its HTTP `Link` headers or its `<link rel="hub">` elements.
+func DiscoverWebSubHub(header http.Header, data []byte) (hub, topic string) {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			href := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || strings.ToLower(kv[0]) != "rel" {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(kv[1], `"`)) {
+					switch strings.ToLower(rel) {
+					case "hub":
+						if hub == "" {
+							hub = href
+						}
+					case "self":
+						if topic == "" {
+							topic = href
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if hub != "" {
+		return hub, topic
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		el, ok := token.(xml.StartElement)
+		if !ok || el.Name.Local != "link" {
+			continue
+		}
+
+		var rel, href string
+		for _, attr := range el.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = attr.Value
+			case "href":
+				href = attr.Value
+			}
+		}
+
+		switch rel {
+		case "hub":
+			if hub == "" {
+				hub = href
+			}
+		case "self":
+			if topic == "" {
+				topic = href
+			}
+		}
+	}
+
+	return hub, topic
+}
+
+// EnsureWebSubSubscription subscribes the feed `name` to the `topic` at the
+// WebSub `hub` unless it already has a subscription that is not due for
+// renewal. The hub verifies the subscription asynchronously via our callback.
+func EnsureWebSubSubscription(conf *Config, name, hub, topic string) error {
+	feed, ok := conf.Feeds[name]
+	if !ok {
+		return fmt.Errorf("error: unknown feed %s", name)
+	}
+
+	sub := feed.webSub
+	if sub != nil && sub.Hub == hub && sub.Topic == topic && !sub.NeedsRenewal(time.Now()) {
+		return nil
+	}
+
+	return SubscribeWebSub(conf, name, hub, topic)
+}
+
+// SubscribeWebSub (re)subscribes the feed `name` to the `topic` at the
+// WebSub `hub` with a new secret, pending until the hub verifies it.
+func SubscribeWebSub(conf *Config, name, hub, topic string) error {
+	feed, ok := conf.Feeds[name]
+	if !ok {
+		return fmt.Errorf("error: unknown feed %s", name)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("error generating websub secret: %w", err)
+	}
+
+	sub := &WebSubSubscription{
+		Hub:     hub,
+		Topic:   topic,
+		Pending: hex.EncodeToString(secret),
+		Updated: time.Now(),
+	}
+
+	// A renewal keeps the current lease and secret until the hub verifies the
+	// new one, so we do not fall back to polling in between.
+	if old := feed.webSub; old.Active(time.Now()) && old.Hub == hub && old.Topic == topic {
+		sub.Secret, sub.Verified, sub.Expires = old.Secret, old.Verified, old.Expires
+	}
+
+	feed.webSub = sub
+	if err := saveWebSub(conf, name, feed); err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.callback":      {WebSubCallbackURL(conf, name)},
+		"hub.secret":        {sub.Pending},
+		"hub.lease_seconds": {strconv.Itoa(webSubLeaseSeconds)},
+	}
+
+	res, err := httpClient.PostForm(hub, form)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("error: hub %s refused subscription: %s %s", hub, res.Status, strings.TrimSpace(string(body)))
+	}
+
+	log.Infof("subscribed %s to %s via websub hub %s", name, topic, hub)
+
+	return nil
+}
+
+// VerifyWebSubSignature verifies the `X-Hub-Signature` header value
+// `signature` of a pushed `body` against the subscription's `secret`.
+func VerifyWebSubSignature(secret, signature string, body []byte) bool {
+	if secret == "" {
+		return false
+	}
+
+	parts := strings.SplitN(signature, "=", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	var h func() hash.Hash
+	switch strings.ToLower(parts[0]) {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+
+	expected, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverWebSubHub(t *testing.T) {
+	t.Run("link headers", func(t *testing.T) {
+		header := http.Header{}
+		header.Add("Link", `<https://hub.example.com/>; rel="hub", <https://example.com/feed.xml>; rel="self"`)
+
+		hub, topic := DiscoverWebSubHub(header, nil)
+		assert.Equal(t, "https://hub.example.com/", hub)
+		assert.Equal(t, "https://example.com/feed.xml", topic)
+	})
+
+	t.Run("feed links", func(t *testing.T) {
+		data := []byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>Example</title>
+    <link>https://example.com/</link>
+    <atom:link rel="hub" href="https://hub.example.com/"/>
+    <atom:link rel="self" href="https://example.com/rss.xml"/>
+  </channel>
+</rss>`)
+
+		hub, topic := DiscoverWebSubHub(http.Header{}, data)
+		assert.Equal(t, "https://hub.example.com/", hub)
+		assert.Equal(t, "https://example.com/rss.xml", topic)
+	})
+
+	t.Run("no hub", func(t *testing.T) {
+		hub, _ := DiscoverWebSubHub(http.Header{}, []byte(`<feed><link href="https://example.com/"/></feed>`))
+		assert.Equal(t, "", hub)
+	})
+}
+
+func TestVerifyWebSubSignature(t *testing.T) {
+	body := []byte("<feed/>")
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, VerifyWebSubSignature("secret", signature, body))
+	assert.False(t, VerifyWebSubSignature("other", signature, body))
+	assert.False(t, VerifyWebSubSignature("secret", signature, []byte("<feed></feed>")))
+	assert.False(t, VerifyWebSubSignature("secret", "md5=abc", body))
+	assert.False(t, VerifyWebSubSignature("secret", "", body))
+	assert.False(t, VerifyWebSubSignature("", "sha256="+hex.EncodeToString(hmac.New(sha256.New, nil).Sum(nil)), nil))
+}
+
+func TestWebSubSubscription(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var subscription url.Values
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(r.ParseForm())
+		subscription = r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+
+	conf := NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.FeedsFile = filepath.Join(conf.DataDir, "feeds.yaml")
+	conf.BaseURL = "https://feeds.example.com"
+	conf.Feeds["example"] = &Feed{Name: "example", URI: "https://example.com/rss.xml"}
+
+	app := &App{conf: conf}
+	router := app.initRoutes()
+
+	require.NoError(EnsureWebSubSubscription(conf, "example", hub.URL, "https://example.com/rss.xml"))
+	assert.Equal("subscribe", subscription.Get("hub.mode"))
+	assert.Equal("https://feeds.example.com/websub/callback/example", subscription.Get("hub.callback"))
+
+	sub := conf.Feeds["example"].webSub
+	require.NotNil(sub)
+	assert.Equal(subscription.Get("hub.secret"), sub.Pending)
+	assert.Empty(sub.Secret)
+	assert.False(sub.Active(time.Now()))
+
+	// Subscriptions are kept as state, not in the feeds file.
+	assert.False(Exists(conf.FeedsFile))
+	reloaded := &Feed{Name: "example"}
+	require.NoError(loadWebSub(conf, "example", reloaded))
+	require.NotNil(reloaded.webSub)
+	assert.Equal(sub.Pending, reloaded.webSub.Pending)
+	assert.True(sub.Updated.Equal(reloaded.webSub.Updated))
+
+	// Subscribing again while pending is a no-op.
+	subscription = nil
+	require.NoError(EnsureWebSubSubscription(conf, "example", hub.URL, "https://example.com/rss.xml"))
+	assert.Nil(subscription)
+
+	verify := func(mode, topic, lease string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"hub.mode":          {mode},
+			"hub.topic":         {topic},
+			"hub.challenge":     {"challenge"},
+			"hub.lease_seconds": {lease},
+		}
+		req := httptest.NewRequest(http.MethodGet, "/websub/callback/example?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := verify("subscribe", "https://example.com/other.xml", "3600")
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.False(sub.Active(time.Now()))
+
+	w = verify("unsubscribe", "https://example.com/rss.xml", "3600")
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.NotNil(conf.Feeds["example"].webSub)
+
+	secret := sub.Pending
+	w = verify("subscribe", "https://example.com/rss.xml", "3600")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("challenge", w.Body.String())
+	assert.Equal(secret, sub.Secret)
+	assert.Empty(sub.Pending)
+	assert.True(sub.Active(time.Now()))
+	assert.False(sub.Active(time.Now().Add(2 * time.Hour)))
+	assert.True(sub.NeedsRenewal(time.Now().Add(2 * time.Hour)))
+
+	// Verifications and denials are only accepted of pending requests.
+	w = verify("subscribe", "https://example.com/rss.xml", "3600")
+	assert.Equal(http.StatusNotFound, w.Code)
+	w = verify("denied", "https://example.com/rss.xml", "")
+	assert.Equal(http.StatusNotFound, w.Code)
+	assert.Equal(sub, conf.Feeds["example"].webSub)
+
+	// A renewal keeps the verified secret until it is verified, with its
+	// lease clamped to the lease we asked for.
+	require.NoError(SubscribeWebSub(conf, "example", hub.URL, "https://example.com/rss.xml"))
+	sub = conf.Feeds["example"].webSub
+	assert.Equal(secret, sub.Secret)
+	assert.Equal(subscription.Get("hub.secret"), sub.Pending)
+	assert.NotEqual(secret, sub.Pending)
+
+	w = verify("subscribe", "https://example.com/rss.xml", "999999999")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(subscription.Get("hub.secret"), sub.Secret)
+	assert.True(sub.Active(time.Now().Add(6 * 24 * time.Hour)))
+	assert.False(sub.Active(time.Now().Add(8 * 24 * time.Hour)))
+
+	// A denied renewal keeps the active subscription.
+	require.NoError(SubscribeWebSub(conf, "example", hub.URL, "https://example.com/rss.xml"))
+	w = verify("denied", "https://example.com/rss.xml", "")
+	assert.Equal(http.StatusOK, w.Code)
+	sub = conf.Feeds["example"].webSub
+	require.NotNil(sub)
+	assert.Empty(sub.Pending)
+	assert.True(sub.Active(time.Now()))
+}